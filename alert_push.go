@@ -1,6 +1,7 @@
 package apns
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -10,36 +11,48 @@ type AlertPush struct {
 	Subtitle string
 	Body     string
 	Sound    string
-}
 
-func (p AlertPush) Send(c *Config, h *Headers) (r Result) {
-	url := fmt.Sprintf(urlMask, c.Host, p.Token)
+	// The importance of the notification; critical alerts also play Sound as a critical sound, at
+	// SoundVolume from 0 (silent) to 1, or at full volume if SoundVolume is nil.
+	InterruptionLevel InterruptionLevel
+	SoundVolume       *float64
 
-	req := make(map[string]interface{})
-	for k, v := range p.Data {
-		req[k] = v
-	}
+	// Optional. From 0 to 1, sorts the notifications of the app in the notification summary.
+	RelevanceScore *float64
+
+	// Optional. Shows the notification only in the Focus matching these criteria.
+	FilterCriteria string
+}
 
+// Payload builds the notification payload.
+func (p AlertPush) Payload() *Payload {
 	if p.Sound == "" {
 		p.Sound = "default"
 	}
 
-	req["apns"] = aps{
-		Badge:    p.Badge,
-		Category: p.Category,
-		ThreadId: p.ThreadId,
-		Sound:    p.Sound,
-		Alert: &alert{
-			Title:   p.Title,
-			Subitle: p.Subtitle,
-			Body:    p.Body,
-		},
+	res := NewPayload().
+		CustomData(p.Data).
+		Category(p.Category).
+		ThreadId(p.ThreadId).
+		Sound(p.Sound).
+		AlertTitle(p.Title).
+		AlertSubtitle(p.Subtitle).
+		AlertBody(p.Body).
+		InterruptionLevel(p.InterruptionLevel).
+		FilterCriteria(p.FilterCriteria)
+	res.Aps.Badge = p.Badge
+	res.Aps.RelevanceScore = p.RelevanceScore
+	if p.InterruptionLevel == InterruptionCritical {
+		res.Aps.Sound = &CriticalSound{Critical: 1, Name: p.Sound, Volume: p.SoundVolume}
 	}
+	return res
+}
 
-	if h == nil {
-		h = new(Headers)
-	}
-	h.PushType = PushTypeAlert
+func (p AlertPush) Send(c *Config, h *Headers) (r Result) {
+	return p.SendContext(context.Background(), c, h)
+}
 
-	return c.Send(url, req, *h, nil)
+func (p AlertPush) SendContext(ctx context.Context, c *Config, h *Headers) (r Result) {
+	url := fmt.Sprintf(urlMask, c.Host, p.Token)
+	return c.SendContext(ctx, url, p.Payload(), pushHeaders(h, PushTypeAlert), nil)
 }
@@ -0,0 +1,69 @@
+package apnstest
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// stallListener keeps the accepted connections, so the Server can stall them.
+type stallListener struct {
+	net.Listener
+	s *Server
+}
+
+func (l *stallListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	sc := &stallConn{Conn: c}
+	l.s.mux.Lock()
+	l.s.netConns = append(l.s.netConns, sc)
+	l.s.mux.Unlock()
+	return sc, nil
+}
+
+// stallConn is a connection that can stop reading without being closed: everything the client sends
+// after stall is dropped, PING frames included.
+type stallConn struct {
+	net.Conn
+
+	mux     sync.Mutex
+	stalled chan struct{}
+}
+
+func (c *stallConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+
+	c.mux.Lock()
+	stalled := c.stalled
+	c.mux.Unlock()
+	if stalled != nil {
+		<-stalled
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+func (c *stallConn) stall() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.stalled == nil {
+		c.stalled = make(chan struct{})
+	}
+}
+
+// release lets a stalled Read return, so the connection can be closed.
+func (c *stallConn) release() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.stalled == nil {
+		c.stalled = make(chan struct{})
+	}
+	select {
+	case <-c.stalled:
+	default:
+		close(c.stalled)
+	}
+}
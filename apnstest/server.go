@@ -0,0 +1,607 @@
+// Package apnstest provides a local HTTP/2 server acting like APNs, for testing code that sends pushes.
+//
+//	srv := apnstest.NewServer()
+//	defer srv.Close()
+//
+//	c := &apns.Config{Bundle: "com.example.app", TeamId: "TEAM", KeyId: "KEY", TokenSigner: signer}
+//	srv.Configure(c)
+//	srv.Enqueue(apnstest.Reject(apns.Unregistered).At(time.Now()))
+//	r := c.SendPayload(ctx, token, apns.NewPayload().AlertBody("hi"), apns.Headers{})
+package apnstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/tada-team/apns"
+)
+
+// Response is an answer scripted by a test.
+type Response struct {
+	// Defaults to 200, or to the status APNs uses for Reason.
+	StatusCode int
+
+	// The reason sent in the body of a failed response.
+	Reason apns.Reason
+
+	// For 410 responses, the time at which the token was no longer valid for the topic.
+	Timestamp time.Time
+
+	// Waits this long before answering.
+	Delay time.Duration
+}
+
+// Reject returns a failed Response with the status APNs uses for reason.
+func Reject(reason apns.Reason) Response {
+	return Response{StatusCode: reasonStatus(reason), Reason: reason}
+}
+
+// At returns a copy of r with Timestamp set.
+func (r Response) At(ts time.Time) Response {
+	r.Timestamp = ts
+	return r
+}
+
+// Request is a request received by the Server.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+
+	// The device token from the path, empty for broadcasts and channel requests.
+	Token string
+
+	// The apns-channel-id of broadcasts and channel requests.
+	ChannelId string
+
+	Topic    string
+	PushType string
+
+	// The apns-id of the request, or the one the server generated and answered with.
+	Id string
+
+	// The claims of the provider token, nil for certificate authentication.
+	Claims jwt.MapClaims
+
+	// The certificate the client connected with, nil for token authentication.
+	Cert *x509.Certificate
+
+	// The answer sent, either the validation failure or the scripted Response.
+	Response Response
+}
+
+// Server is a local APNs. Every request is validated like APNs does, then answered with the next
+// Enqueue-d response, the Respond function, or 200.
+type Server struct {
+	// The address to use as Config.Host.
+	Host string
+
+	// The certificate authority of the server, for TransportOpts.RootCAs.
+	RootCAs *x509.CertPool
+
+	srv *httptest.Server
+
+	mux       sync.Mutex
+	publicKey *ecdsa.PublicKey
+	keyId     string
+	teamId    string
+	topics    []string
+	queue     []Response
+	respond   func(r *Request) Response
+	requests  []Request
+	channels  map[string]int
+	conns     int
+	netConns  []*stallConn
+}
+
+// NewServer starts a Server. Provider tokens are not verified until SetPublicKey is called.
+func NewServer() *Server {
+	s := new(Server)
+	s.srv = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	s.srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			s.mux.Lock()
+			s.conns++
+			s.mux.Unlock()
+		}
+	}
+	s.srv.Listener = &stallListener{Listener: s.srv.Listener, s: s}
+	s.srv.EnableHTTP2 = true
+	s.srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	s.srv.StartTLS()
+
+	s.Host = s.srv.Listener.Addr().String()
+	s.RootCAs = x509.NewCertPool()
+	s.RootCAs.AddCert(s.srv.Certificate())
+	return s
+}
+
+// Configure points c at the server.
+func (s *Server) Configure(c *apns.Config) {
+	c.Host = s.Host
+	c.Transport.RootCAs = s.RootCAs
+}
+
+// Connections returns the number of connections accepted so far.
+func (s *Server) Connections() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.conns
+}
+
+// CloseConnections drops every client connection, like APNs does with idle ones.
+func (s *Server) CloseConnections() {
+	s.srv.CloseClientConnections()
+}
+
+// StallConnections stops reading from every open client connection without closing it, like a
+// connection APNs dropped silently: requests and PING frames get no answer. New connections are served.
+func (s *Server) StallConnections() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, c := range s.netConns {
+		c.stall()
+	}
+}
+
+func (s *Server) Close() {
+	s.mux.Lock()
+	for _, c := range s.netConns {
+		c.release()
+	}
+	s.mux.Unlock()
+	s.srv.Close()
+}
+
+// SetPublicKey makes the server verify the signature of provider tokens with a PEM public key, such as
+// the one of MemorySigner.PublicKeyPEM. The key id and team id are checked if not empty.
+func (s *Server) SetPublicKey(pemBytes []byte, keyId, teamId string) error {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return errors.New("no pem block")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return errors.Wrap(err, "parse public key fail")
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("not ecdsa key")
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.publicKey = ecKey
+	s.keyId = keyId
+	s.teamId = teamId
+	return nil
+}
+
+// SetTopics restricts the topics accepted by the server. Nil accepts any topic.
+func (s *Server) SetTopics(topics ...string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.topics = topics
+}
+
+// Enqueue adds responses for the next valid requests, in order.
+func (s *Server) Enqueue(responses ...Response) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.queue = append(s.queue, responses...)
+}
+
+// Respond sets the function answering valid requests once the Enqueue-d responses are used up.
+func (s *Server) Respond(fn func(r *Request) Response) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.respond = fn
+}
+
+// Requests returns every request received so far.
+func (s *Server) Requests() []Request {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	res := make([]Request, len(s.requests))
+	copy(res, s.requests)
+	return res
+}
+
+// Reset forgets the received requests and the scripted responses.
+func (s *Server) Reset() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.requests = nil
+	s.queue = nil
+	s.respond = nil
+	s.channels = nil
+}
+
+// serveChannels answers channel management requests. Channels are kept until Reset; scripted responses
+// are not used.
+func (s *Server) serveChannels(w http.ResponseWriter, r *http.Request, req *Request) {
+	var data interface{}
+	resp, ok := s.validateAuth(r, req)
+	if ok {
+		resp, data, ok = s.channelRequest(w, r, req)
+	}
+	if resp.StatusCode == 0 {
+		resp.StatusCode = http.StatusOK
+	}
+	req.Response = resp
+
+	s.mux.Lock()
+	s.requests = append(s.requests, *req)
+	s.mux.Unlock()
+
+	w.Header().Set("apns-request-id", r.Header.Get("apns-request-id"))
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.StatusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{"reason": resp.Reason})
+		return
+	}
+	if data != nil {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(resp.StatusCode)
+	if data != nil {
+		json.NewEncoder(w).Encode(data)
+	}
+}
+
+// channelRequest runs a channel management request and returns the response and its JSON body, if any.
+func (s *Server) channelRequest(w http.ResponseWriter, r *http.Request, req *Request) (Response, interface{}, bool) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/1/apps/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		return Reject(apns.BadPath), nil, false
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.channels == nil {
+		s.channels = make(map[string]int)
+	}
+
+	switch {
+	case parts[1] == "all-channels" && r.Method == http.MethodGet:
+		ids := make([]string, 0, len(s.channels))
+		for id := range s.channels {
+			ids = append(ids, id)
+		}
+		return Response{}, map[string]interface{}{"channels": ids}, true
+
+	case parts[1] == "channels" && r.Method == http.MethodPost:
+		data := new(struct {
+			Policy   *int   `json:"message-storage-policy"`
+			PushType string `json:"push-type"`
+		})
+		if err := json.Unmarshal(req.Body, data); err != nil || data.PushType != "LiveActivity" {
+			return Reject(apns.InvalidPushType), nil, false
+		}
+		if data.Policy == nil || *data.Policy != 0 && *data.Policy != 1 {
+			return Reject(apns.BadMessageStoragePolicy), nil, false
+		}
+		b := make([]byte, 16)
+		rand.Read(b)
+		req.ChannelId = base64.StdEncoding.EncodeToString(b)
+		s.channels[req.ChannelId] = *data.Policy
+		w.Header().Set("apns-channel-id", req.ChannelId)
+		return Response{StatusCode: http.StatusCreated}, nil, true
+
+	case parts[1] == "channels" && (r.Method == http.MethodGet || r.Method == http.MethodDelete):
+		if req.ChannelId == "" {
+			return Reject(apns.MissingChannelId), nil, false
+		}
+		policy, ok := s.channels[req.ChannelId]
+		if !ok {
+			return Reject(apns.ChannelNotRegistered), nil, false
+		}
+		if r.Method == http.MethodDelete {
+			delete(s.channels, req.ChannelId)
+			return Response{StatusCode: http.StatusNoContent}, nil, true
+		}
+		return Response{}, map[string]interface{}{"message-storage-policy": policy, "push-type": "LiveActivity"}, true
+
+	case parts[1] == "channels" || parts[1] == "all-channels":
+		return Reject(apns.MethodNotAllowed), nil, false
+	}
+	return Reject(apns.BadPath), nil, false
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	req := &Request{
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Header:    r.Header,
+		Body:      body,
+		Topic:     r.Header.Get("apns-topic"),
+		PushType:  r.Header.Get("apns-push-type"),
+		Id:        r.Header.Get("apns-id"),
+		ChannelId: r.Header.Get("apns-channel-id"),
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		req.Cert = r.TLS.PeerCertificates[0]
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/1/apps/") {
+		s.serveChannels(w, r, req)
+		return
+	}
+
+	resp, ok := s.validate(r, req)
+	if ok {
+		resp = s.next(req)
+	}
+	if resp.StatusCode == 0 {
+		resp.StatusCode = http.StatusOK
+		if resp.Reason != "" {
+			resp.StatusCode = reasonStatus(resp.Reason)
+		}
+	}
+	req.Response = resp
+	if req.Id == "" {
+		req.Id = newUUID()
+	}
+
+	s.mux.Lock()
+	s.requests = append(s.requests, *req)
+	s.mux.Unlock()
+
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(resp.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	w.Header().Set("apns-id", req.Id)
+	if resp.StatusCode == http.StatusOK {
+		w.Header().Set("apns-unique-id", newUUID())
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	data := map[string]interface{}{"reason": resp.Reason}
+	if !resp.Timestamp.IsZero() {
+		data["timestamp"] = resp.Timestamp.UnixNano() / int64(time.Millisecond)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func (s *Server) next(req *Request) Response {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if len(s.queue) > 0 {
+		resp := s.queue[0]
+		s.queue = s.queue[1:]
+		return resp
+	}
+	if s.respond != nil {
+		return s.respond(req)
+	}
+	return Response{}
+}
+
+var (
+	uuidRe  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	tokenRe = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+
+	pushTypes = map[string]bool{
+		"alert":        true,
+		"background":   true,
+		"location":     true,
+		"voip":         true,
+		"complication": true,
+		"fileprovider": true,
+		"mdm":          true,
+		"liveactivity": true,
+		"pushtotalk":   true,
+		"widgets":      true,
+		"controls":     true,
+	}
+)
+
+// validate checks the request the way APNs does, in the same order, and returns the failure if any.
+func (s *Server) validate(r *http.Request, req *Request) (Response, bool) {
+	if r.Method != http.MethodPost {
+		return Reject(apns.MethodNotAllowed), false
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/3/device/"):
+		req.Token = strings.TrimPrefix(r.URL.Path, "/3/device/")
+		if req.Token == "" {
+			return Reject(apns.MissingDeviceToken), false
+		}
+		if !tokenRe.MatchString(req.Token) {
+			return Reject(apns.BadDeviceToken), false
+		}
+	case strings.HasPrefix(r.URL.Path, "/4/broadcasts/apps/"):
+		if req.ChannelId == "" {
+			return Reject(apns.MissingChannelId), false
+		}
+		s.mux.Lock()
+		_, ok := s.channels[req.ChannelId]
+		s.mux.Unlock()
+		if !ok {
+			return Reject(apns.ChannelNotRegistered), false
+		}
+		if req.PushType != "liveactivity" {
+			return Reject(apns.InvalidPushType), false
+		}
+	default:
+		return Reject(apns.BadPath), false
+	}
+
+	for k, v := range r.Header {
+		if len(v) > 1 && strings.HasPrefix(strings.ToLower(k), "apns-") {
+			return Reject(apns.DuplicateHeaders), false
+		}
+	}
+	if req.Id != "" && !uuidRe.MatchString(req.Id) {
+		return Reject(apns.BadMessageId), false
+	}
+	if v := r.Header.Get("apns-expiration"); v != "" {
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			return Reject(apns.BadExpirationDate), false
+		}
+	}
+	if v := r.Header.Get("apns-priority"); v != "" && v != "1" && v != "5" && v != "10" {
+		return Reject(apns.BadPriority), false
+	}
+	if len(r.Header.Get("apns-collapse-id")) > 64 {
+		return Reject(apns.BadCollapseId), false
+	}
+	if req.PushType != "" && !pushTypes[req.PushType] {
+		return Reject(apns.InvalidPushType), false
+	}
+
+	if resp, ok := s.validateAuth(r, req); !ok {
+		return resp, false
+	}
+
+	if req.Topic == "" && req.Cert == nil && req.ChannelId == "" {
+		return Reject(apns.MissingTopic), false
+	}
+	s.mux.Lock()
+	topics := s.topics
+	s.mux.Unlock()
+	if req.Topic != "" && topics != nil && !contains(topics, req.Topic) {
+		return Reject(apns.TopicDisallowed), false
+	}
+
+	if len(req.Body) == 0 {
+		return Reject(apns.PayloadEmpty), false
+	}
+	maxSize := 4096
+	if req.PushType == "voip" {
+		maxSize = 5120
+	}
+	if len(req.Body) > maxSize {
+		return Reject(apns.PayloadTooLarge), false
+	}
+	return Response{}, true
+}
+
+func (s *Server) validateAuth(r *http.Request, req *Request) (Response, bool) {
+	auth := r.Header.Get("authorization")
+	if auth == "" {
+		if req.Cert != nil {
+			return Response{}, true
+		}
+		return Reject(apns.MissingProviderToken), false
+	}
+	if !strings.HasPrefix(auth, "bearer ") {
+		return Reject(apns.InvalidProviderToken), false
+	}
+
+	s.mux.Lock()
+	publicKey, keyId, teamId := s.publicKey, s.keyId, s.teamId
+	s.mux.Unlock()
+
+	claims := jwt.MapClaims{}
+	parser := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodES256.Alg()}, SkipClaimsValidation: true}
+	raw := strings.TrimPrefix(auth, "bearer ")
+
+	var token *jwt.Token
+	var err error
+	if publicKey != nil {
+		token, err = parser.ParseWithClaims(raw, claims, func(*jwt.Token) (interface{}, error) {
+			return publicKey, nil
+		})
+	} else {
+		token, _, err = parser.ParseUnverified(raw, claims)
+	}
+	if err != nil {
+		return Reject(apns.InvalidProviderToken), false
+	}
+	req.Claims = claims
+
+	if kid, _ := token.Header["kid"].(string); kid == "" || keyId != "" && kid != keyId {
+		return Reject(apns.InvalidProviderToken), false
+	}
+	if iss, _ := claims["iss"].(string); iss == "" || teamId != "" && iss != teamId {
+		return Reject(apns.InvalidProviderToken), false
+	}
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return Reject(apns.InvalidProviderToken), false
+	}
+	if time.Since(time.Unix(int64(iat), 0)) > time.Hour {
+		return Reject(apns.ExpiredProviderToken), false
+	}
+	return Response{}, true
+}
+
+func reasonStatus(reason apns.Reason) int {
+	switch reason {
+	case apns.BadCertificate, apns.BadCertificateEnvironment, apns.ExpiredProviderToken, apns.Forbidden,
+		apns.InvalidProviderToken, apns.MissingProviderToken, apns.UnrelatedKeyIdInToken,
+		apns.BadEnvironmentKeyInToken:
+		return http.StatusForbidden
+	case apns.BadPath, apns.ChannelNotRegistered:
+		return http.StatusNotFound
+	case apns.MethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case apns.ExpiredToken, apns.Unregistered:
+		return http.StatusGone
+	case apns.PayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case apns.TooManyProviderTokenUpdates, apns.TooManyRequests:
+		return http.StatusTooManyRequests
+	case apns.InternalServerError:
+		return http.StatusInternalServerError
+	case apns.ServiceUnavailable, apns.Shutdown:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:])
+}
@@ -0,0 +1,52 @@
+package apnstest_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tada-team/apns/apnstest"
+)
+
+func TestServerRequestId(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		id   string
+	}{
+		{name: "sent", id: "8e9d1e7c-4f30-4ae2-8b8f-1c2b5a1b6f7d"},
+		{name: "generated"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := apnstest.NewServer()
+			defer srv.Close()
+
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{RootCAs: srv.RootCAs},
+				ForceAttemptHTTP2: true,
+			}}
+			req, err := http.NewRequest(http.MethodPost, "https://"+srv.Host+"/3/device/0123456789abcdef", strings.NewReader(`{"aps":{}}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("apns-topic", "com.example.app")
+			if tt.id != "" {
+				req.Header.Set("apns-id", tt.id)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			id := resp.Header.Get("apns-id")
+			if id == "" || tt.id != "" && id != tt.id {
+				t.Errorf("apns-id: got %q, want %q", id, tt.id)
+			}
+			reqs := srv.Requests()
+			if len(reqs) != 1 || reqs[0].Id != id {
+				t.Errorf("recorded requests: got %d, want 1 with id %s", len(reqs), id)
+			}
+		})
+	}
+}
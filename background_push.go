@@ -1,6 +1,7 @@
 package apns
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -12,25 +13,22 @@ type BackgroundPush struct {
 	Token    string
 }
 
-func (p BackgroundPush) Send(c *Config, h *Headers) (r Result) {
-	url := fmt.Sprintf(urlMask, c.Host, p.Token)
-
-	req := make(map[string]interface{})
-	for k, v := range p.Data {
-		req[k] = v
-	}
-
-	req["apns"] = aps{
-		ContentAvailable: 1,
-		Badge:            p.Badge,
-		Category:         p.Category,
-		ThreadId:         p.ThreadId,
-	}
+// Payload builds the notification payload.
+func (p BackgroundPush) Payload() *Payload {
+	res := NewPayload().
+		CustomData(p.Data).
+		ContentAvailable().
+		Category(p.Category).
+		ThreadId(p.ThreadId)
+	res.Aps.Badge = p.Badge
+	return res
+}
 
-	if h == nil {
-		h = new(Headers)
-	}
-	h.PushType = PushTypeBackground
+func (p BackgroundPush) Send(c *Config, h *Headers) (r Result) {
+	return p.SendContext(context.Background(), c, h)
+}
 
-	return c.Send(url, req, *h, nil)
+func (p BackgroundPush) SendContext(ctx context.Context, c *Config, h *Headers) (r Result) {
+	url := fmt.Sprintf(urlMask, c.Host, p.Token)
+	return c.SendContext(ctx, url, p.Payload(), pushHeaders(h, PushTypeBackground), nil)
 }
@@ -0,0 +1,139 @@
+package apns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const defaultBulkConcurrency = 64
+
+// BulkResult is the result of one push of a bulk send.
+type BulkResult struct {
+	// The position of the push in the tokens or pushes passed in.
+	Index int
+
+	// The device token, for SendBulk and SendBulkChan.
+	Token string
+
+	Result
+}
+
+// SendBulk sends the same payload to every token, at most concurrency pushes at a time (64 if zero),
+// and calls fn with each result as soon as it is known. fn is never called concurrently. The payload
+// is marshalled once. h.Id is ignored, every push gets its own apns-id. If ctx is done, the pushes not
+// sent yet are reported as Canceled. SendBulk returns when every token has a result.
+func (c *Config) SendBulk(ctx context.Context, tokens []string, payload interface{}, h Headers, concurrency int, fn func(BulkResult)) error {
+	body, h, err := c.bulkPayload(payload, h)
+	if err != nil {
+		return err
+	}
+
+	c.sendBulk(ctx, tokens, body, h, concurrency, fn)
+	return nil
+}
+
+// SendBulkChan is SendBulk with results delivered on a channel, which is closed after the last one.
+// Once ctx is done, results not received yet are dropped and the channel is closed, so a caller that
+// stops reading early must cancel ctx.
+func (c *Config) SendBulkChan(ctx context.Context, tokens []string, payload interface{}, h Headers, concurrency int) (<-chan BulkResult, error) {
+	body, h, err := c.bulkPayload(payload, h)
+	if err != nil {
+		return nil, err
+	}
+
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	}
+	ch := make(chan BulkResult, concurrency)
+	go func() {
+		defer close(ch)
+		c.sendBulk(ctx, tokens, body, h, concurrency, func(r BulkResult) {
+			select {
+			case ch <- r:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return ch, nil
+}
+
+// SendPushes sends every push with a copy of h (which may be nil), at most concurrency pushes
+// at a time, and calls fn with each result like SendBulk does.
+func (c *Config) SendPushes(ctx context.Context, pushes []Push, h *Headers, concurrency int, fn func(BulkResult)) {
+	runBulk(ctx, len(pushes), concurrency, fn, func(i int) BulkResult {
+		res := BulkResult{Index: i}
+		hh := new(Headers)
+		if h != nil {
+			*hh = *h
+			hh.Id = ""
+		}
+		if err := ctx.Err(); err != nil {
+			res.Code = Canceled
+			res.Error = err
+			return res
+		}
+		res.Result = pushes[i].SendContext(ctx, c, hh)
+		return res
+	})
+}
+
+func (c *Config) bulkPayload(payload interface{}, h Headers) (json.RawMessage, Headers, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, h, errors.Wrap(err, "json fail")
+	}
+	if p, ok := payload.(*Payload); ok && h.PushType == "" {
+		h.PushType = p.pushType()
+	}
+	h.Id = ""
+	return body, h, nil
+}
+
+func (c *Config) sendBulk(ctx context.Context, tokens []string, body json.RawMessage, h Headers, concurrency int, fn func(BulkResult)) {
+	runBulk(ctx, len(tokens), concurrency, fn, func(i int) BulkResult {
+		res := BulkResult{Index: i, Token: tokens[i]}
+		if err := ctx.Err(); err != nil {
+			res.Code = Canceled
+			res.Error = err
+			return res
+		}
+		res.Result = c.SendContext(ctx, fmt.Sprintf(urlMask, c.Host, tokens[i]), body, h, nil)
+		return res
+	})
+}
+
+func runBulk(ctx context.Context, n, concurrency int, fn func(BulkResult), send func(i int) BulkResult) {
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	}
+	if concurrency > n {
+		concurrency = n
+	}
+
+	var mux sync.Mutex
+	var wg sync.WaitGroup
+	next := make(chan int)
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				res := send(i)
+				mux.Lock()
+				fn(res)
+				mux.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
@@ -0,0 +1,83 @@
+package apns_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tada-team/apns"
+	"github.com/tada-team/apns/apnstest"
+)
+
+func TestSendBulkChan(t *testing.T) {
+	const (
+		tokens      = 100
+		concurrency = 4
+	)
+
+	for _, tt := range []struct {
+		name string
+		read int // results read before ctx is canceled, all if zero
+	}{
+		{name: "drained"},
+		{name: "abandoned", read: 3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := newTestConfig(t)
+			srv.Respond(func(r *apnstest.Request) apnstest.Response {
+				return apnstest.Response{Delay: 5 * time.Millisecond}
+			})
+
+			list := make([]string, tokens)
+			for i := range list {
+				list[i] = testToken
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			payload := apns.NewPayload().AlertBody("Hi")
+			ch, err := c.SendBulkChan(ctx, list, payload, apns.Headers{}, concurrency)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.read == 0 {
+				n := 0
+				for r := range ch {
+					if r.Code != apns.Ok {
+						t.Errorf("push %d: %v", r.Index, r.Error)
+					}
+					n++
+				}
+				if n != tokens {
+					t.Errorf("results: got %d, want %d", n, tokens)
+				}
+				return
+			}
+
+			for i := 0; i < tt.read; i++ {
+				<-ch
+			}
+			cancel()
+
+			// the sender must not block on the results nobody reads: it drops them and closes the channel
+			time.Sleep(200 * time.Millisecond)
+			n := 0
+			timeout := time.After(5 * time.Second)
+			for {
+				select {
+				case _, ok := <-ch:
+					if !ok {
+						if n > concurrency {
+							t.Errorf("results after cancel: got %d, want at most %d", n, concurrency)
+						}
+						return
+					}
+					n++
+				case <-timeout:
+					t.Fatal("channel not closed")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package apns
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// Apple push certificate extension listing every topic the certificate may send to.
+	oidTopics = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 3, 6}
+
+	// The UID attribute of the certificate subject. Single-topic certificates keep the bundle ID here.
+	oidUid = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}
+)
+
+type pushCert struct {
+	tls    tls.Certificate
+	topics []string
+
+	// The subject UID. For MDM push certificates this is the topic of every push.
+	uid string
+}
+
+func (c *pushCert) allows(topic string) bool {
+	if topic != "" && topic == c.uid {
+		return true
+	}
+	for _, v := range c.topics {
+		if v == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// loadCert parses a .p12 file, or a PEM certificate with the key either
+// in the same block list or in key.
+func loadCert(data, key []byte, password string) (*pushCert, error) {
+	var cert tls.Certificate
+
+	if block, _ := pem.Decode(data); block != nil {
+		if len(key) == 0 {
+			key = data
+		}
+		v, err := tls.X509KeyPair(data, key)
+		if err != nil {
+			return nil, errors.Wrap(err, "pem key pair fail")
+		}
+		cert = v
+	} else {
+		key, leaf, chain, err := decodePKCS12(data, password)
+		if err != nil {
+			return nil, err
+		}
+		cert = tls.Certificate{
+			Certificate: [][]byte{leaf.Raw},
+			PrivateKey:  key,
+			Leaf:        leaf,
+		}
+		for _, v := range chain {
+			cert.Certificate = append(cert.Certificate, v.Raw)
+		}
+	}
+
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, errors.Wrap(err, "x509.ParseCertificate")
+		}
+		cert.Leaf = leaf
+	}
+
+	topics, err := certTopics(cert.Leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pushCert{tls: cert, topics: topics, uid: certUid(cert.Leaf)}, nil
+}
+
+func certUid(cert *x509.Certificate) string {
+	for _, name := range cert.Subject.Names {
+		if name.Type.Equal(oidUid) {
+			if s, ok := name.Value.(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// certTopics returns the topics from the 1.2.840.113635.100.6.3.6 extension,
+// falling back to the subject UID for certificates without it.
+func certTopics(cert *x509.Certificate) ([]string, error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidTopics) {
+			continue
+		}
+
+		// SEQUENCE { UTF8String topic, SEQUENCE { UTF8String kind, ... }, ... }
+		var seq asn1.RawValue
+		if rest, err := asn1.Unmarshal(ext.Value, &seq); err != nil {
+			return nil, errors.Wrap(err, "topics extension parse fail")
+		} else if len(rest) > 0 {
+			return nil, fmt.Errorf("topics extension: trailing data")
+		}
+
+		var topics []string
+		for data := seq.Bytes; len(data) > 0; {
+			var v asn1.RawValue
+			rest, err := asn1.Unmarshal(data, &v)
+			if err != nil {
+				return nil, errors.Wrap(err, "topics extension parse fail")
+			}
+			data = rest
+			if v.Class == asn1.ClassUniversal && v.Tag == asn1.TagUTF8String {
+				topics = append(topics, string(v.Bytes))
+			}
+		}
+		return topics, nil
+	}
+
+	if uid := certUid(cert); uid != "" {
+		return []string{uid}, nil
+	}
+	return nil, nil
+}
+
+func (c *Config) usesCert() bool {
+	return len(c.Cert) > 0
+}
+
+func (c *Config) getCertLocked() (*pushCert, error) {
+	if c.cert == nil {
+		cert, err := loadCert(c.Cert, c.CertKey, c.CertPassword)
+		if err != nil {
+			return nil, err
+		}
+		c.cert = cert
+	}
+	return c.cert, nil
+}
+
+func (c *Config) getCert() (*pushCert, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.getCertLocked()
+}
@@ -0,0 +1,181 @@
+package apns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	broadcastMask   = "https://%s/4/broadcasts/apps/%s"
+	channelsMask    = "https://%s/1/apps/%s/channels"
+	allChannelsMask = "https://%s/1/apps/%s/all-channels"
+
+	channelHostProduction  = "api-manage-broadcast.push.apple.com:2196"
+	channelHostDevelopment = "api-manage-broadcast.sandbox.push.apple.com:2195"
+)
+
+// MessageStoragePolicy tells APNs whether to keep the last broadcast of a channel for devices that are
+// offline when it is sent.
+type MessageStoragePolicy int
+
+const (
+	// Broadcasts are delivered only to devices that are online.
+	NoMessageStored = MessageStoragePolicy(0)
+
+	// The most recent broadcast is stored and delivered to devices when they come online.
+	MostRecentMessageStored = MessageStoragePolicy(1)
+)
+
+// Channel is a broadcast channel of the Config bundle. Every Live Activity subscribed to the channel
+// receives the pushes sent to it with Config.Broadcast.
+type Channel struct {
+	Id                   string               `json:"-"`
+	MessageStoragePolicy MessageStoragePolicy `json:"message-storage-policy"`
+
+	// Always LiveActivity.
+	PushType string `json:"push-type"`
+}
+
+func (c *Config) channelHost() string {
+	if c.ChannelHost != "" {
+		return c.ChannelHost
+	}
+	switch strings.TrimSuffix(c.Host, ":443") {
+	case "api.push.apple.com":
+		return channelHostProduction
+	case "api.sandbox.push.apple.com", "api.development.push.apple.com":
+		return channelHostDevelopment
+	}
+	return c.Host
+}
+
+// CreateChannel creates a broadcast channel and returns its id.
+func (c *Config) CreateChannel(ctx context.Context, policy MessageStoragePolicy) (string, error) {
+	url := fmt.Sprintf(channelsMask, c.channelHost(), c.Bundle)
+	header, _, err := c.channelRequest(ctx, http.MethodPost, url, "", &Channel{
+		MessageStoragePolicy: policy,
+		PushType:             "LiveActivity",
+	})
+	if err != nil {
+		return "", err
+	}
+	id := header.Get("apns-channel-id")
+	if id == "" {
+		return "", errors.New("no channel id in response")
+	}
+	return id, nil
+}
+
+// Channels returns the ids of every broadcast channel of the bundle.
+func (c *Config) Channels(ctx context.Context) ([]string, error) {
+	url := fmt.Sprintf(allChannelsMask, c.channelHost(), c.Bundle)
+	_, body, err := c.channelRequest(ctx, http.MethodGet, url, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	data := new(struct {
+		Channels []string `json:"channels"`
+	})
+	if err := json.Unmarshal(body, data); err != nil {
+		return nil, errors.Wrap(err, "json fail")
+	}
+	return data.Channels, nil
+}
+
+// Channel returns the settings of a broadcast channel.
+func (c *Config) Channel(ctx context.Context, id string) (*Channel, error) {
+	url := fmt.Sprintf(channelsMask, c.channelHost(), c.Bundle)
+	_, body, err := c.channelRequest(ctx, http.MethodGet, url, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := &Channel{Id: id}
+	if err := json.Unmarshal(body, res); err != nil {
+		return nil, errors.Wrap(err, "json fail")
+	}
+	return res, nil
+}
+
+// DeleteChannel deletes a broadcast channel. Live Activities subscribed to it stop receiving broadcasts.
+func (c *Config) DeleteChannel(ctx context.Context, id string) error {
+	url := fmt.Sprintf(channelsMask, c.channelHost(), c.Bundle)
+	_, _, err := c.channelRequest(ctx, http.MethodDelete, url, id, nil)
+	return err
+}
+
+// Broadcast sends a Live Activity push to every device subscribed to a channel. If h.PushType is empty
+// it is set to liveactivity.
+func (c *Config) Broadcast(ctx context.Context, channelId string, payload interface{}, h Headers) Result {
+	h.ChannelId = channelId
+	if h.PushType == "" {
+		h.PushType = PushTypeLiveActivity
+	}
+	return c.SendContext(ctx, fmt.Sprintf(broadcastMask, c.Host, c.Bundle), payload, h, nil)
+}
+
+// channelRequest sends a channel management request. Failures APNs reports are returned as *Error.
+func (c *Config) channelRequest(ctx context.Context, method, url, channelId string, req interface{}) (http.Header, []byte, error) {
+	var body io.Reader
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "json fail")
+		}
+		body = bytes.NewReader(b)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "new request fail")
+	}
+	request.Header.Set("apns-request-id", newUUID())
+	if channelId != "" {
+		request.Header.Set("apns-channel-id", channelId)
+	}
+	if req != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	var token string
+	if !c.usesCert() {
+		if token, err = c.getToken(ctx); err != nil {
+			return nil, nil, errors.Wrap(err, "get token fail")
+		}
+		request.Header.Set("Authorization", "bearer "+token)
+	}
+
+	client, err := c.getChannelClient()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "get client fail")
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "client do fail")
+	}
+	defer response.Body.Close()
+
+	respBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "read all fail")
+	}
+
+	if response.StatusCode >= 400 {
+		apnsErr, err := parseError(response.StatusCode, response.Header.Get("apns-request-id"), respBody)
+		if err != nil {
+			return nil, nil, errors.Errorf("channel request fail: status %d", response.StatusCode)
+		}
+		if apnsErr.Reason == ExpiredProviderToken {
+			c.resetToken(ctx, token)
+		}
+		return nil, nil, apnsErr
+	}
+	return response.Header, respBody, nil
+}
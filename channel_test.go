@@ -0,0 +1,76 @@
+package apns_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/tada-team/apns"
+	"github.com/tada-team/apns/apnstest"
+)
+
+func TestBroadcast(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cert bool
+	}{
+		{name: "token"},
+		{name: "certificate", cert: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var c *apns.Config
+			var srv *apnstest.Server
+			if tt.cert {
+				p12, err := ioutil.ReadFile(filepath.Join("testdata", "p12_aes_sha256.p12"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				c = &apns.Config{Bundle: "com.example.app", Cert: p12, CertPassword: "test"}
+				srv = apnstest.NewServer()
+				srv.Configure(c)
+				t.Cleanup(func() {
+					c.Close()
+					srv.Close()
+				})
+			} else {
+				c, srv = newTestConfig(t)
+			}
+
+			ctx := context.Background()
+			id, err := c.CreateChannel(ctx, apns.MostRecentMessageStored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ch, err := c.Channel(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ch.MessageStoragePolicy != apns.MostRecentMessageStored {
+				t.Errorf("policy: got %v", ch.MessageStoragePolicy)
+			}
+
+			payload := apns.LiveActivityPush{Event: apns.LiveActivityUpdate, ContentState: map[string]int{"score": 1}}.Payload()
+			if r := c.Broadcast(ctx, id, payload, apns.Headers{}); r.Code != apns.Ok {
+				t.Fatalf("code: got %v (%v)", r.Code, r.Error)
+			}
+
+			reqs := srv.Requests()
+			req := reqs[len(reqs)-1]
+			if req.ChannelId != id || req.Path != "/4/broadcasts/apps/com.example.app" {
+				t.Errorf("broadcast: channel %s, path %s", req.ChannelId, req.Path)
+			}
+			if (req.Cert != nil) != tt.cert {
+				t.Errorf("client certificate: got %v, want %v", req.Cert != nil, tt.cert)
+			}
+
+			if err := c.DeleteChannel(ctx, id); err != nil {
+				t.Fatal(err)
+			}
+			if r := c.Broadcast(ctx, id, payload, apns.Headers{}); !errors.Is(r.Error, apns.ChannelNotRegistered) {
+				t.Errorf("deleted channel: got %v", r.Error)
+			}
+		})
+	}
+}
@@ -2,12 +2,11 @@ package apns
 
 import (
 	"bytes"
+	"context"
+	"crypto"
 	"crypto/ecdsa"
-	"crypto/rsa"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -15,8 +14,6 @@ import (
 	"sync"
 	"time"
 
-	"golang.org/x/crypto/pkcs12"
-
 	"golang.org/x/net/http2"
 
 	"github.com/dgrijalva/jwt-go"
@@ -24,67 +21,207 @@ import (
 )
 
 type Config struct {
-	Host         string
-	Bundle       string
-	KeyId        string
-	TeamId       string
-	AuthKey      []byte
-	SafariCert   []byte
+	Host       string
+	Bundle     string
+	KeyId      string
+	TeamId     string
+	AuthKey    []byte
+	SafariCert []byte
+
+	// Passphrase of the .p12 SafariCert.
+	SafariCertPassword string
+
+	// Optional. Signs provider tokens instead of AuthKey, e.g. a PKCS#11 or cloud KMS key.
+	// Must hold a P-256 key.
+	Signer crypto.Signer
+
+	// Optional. Signs provider tokens instead of AuthKey and Signer.
+	TokenSigner TokenSigner
+
+	// Optional. Shares provider tokens with other processes using the same TeamId and KeyId.
+	TokenStore TokenStore
+
+	// The token age at which StartTokenRefresh replaces the provider token, plus a random delay of up
+	// to TokenRotationJitter so a fleet does not refresh at once. Default to 45 and 5 minutes. The sum
+	// is kept between 20 and 59 minutes.
+	TokenRotation       time.Duration
+	TokenRotationJitter time.Duration
+
+	// Push certificate for certificate-based authentication: a .p12 file, or a PEM certificate. If set,
+	// pushes are authenticated with the certificate instead of a provider token and AuthKey is ignored.
+	Cert []byte
+
+	// PEM private key for a PEM Cert. May be empty if Cert contains the key too.
+	CertKey []byte
+
+	// Passphrase of a .p12 Cert.
+	CertPassword string
+
+	// Optional. Called when APNs reports a device token is no longer valid for the topic, with the time
+	// APNs confirmed it (zero if not reported). The app may have registered the same token again after that
+	// time, so only remove it if it was last registered before since.
+	OnInvalidToken func(token string, reason Reason, since time.Time)
+
+	// Optional. Retries pushes that failed with RetryNow or RetryLater.
+	Retry *RetryPolicy
+
+	// Checks every push with Validate before it is sent. An invalid push fails with FailNow and a
+	// ValidationError.
+	Validate bool
+
+	// Optional. Limits how fast pushes are sent to one device token and to one topic. The limit applies
+	// once per push: the attempts made by Retry are paced by its backoff only.
+	RateLimit *RateLimiter
+
+	// The channel management host of broadcast channels. Defaults to the production or development
+	// management host matching Host, or to Host itself for any other host.
+	ChannelHost string
+
+	Transport    TransportOpts
 	mux          sync.Mutex
+	tokenMux     sync.Mutex
 	authKey      *ecdsa.PrivateKey
 	tokenValue   *string
 	generated    *time.Time
+	signed       *time.Time
+	refreshStop  chan struct{}
 	safariClient *http.Client
+	client       *http.Client
+	pool         *connPool
+	cert         *pushCert
+
+	channelClient *http.Client
+	channelPool   *connPool
 }
 
 const urlMask = "https://%s/3/device/%s"
 
+const (
+	// APNs rejects provider tokens older than one hour.
+	tokenLifetime = 59 * time.Minute
+
+	// APNs rejects provider tokens refreshed more often than once per 20 minutes.
+	minTokenRefresh = 20 * time.Minute
+
+	tokenClockSkew = time.Minute
+)
+
 func (c *Config) Send(url string, req interface{}, headers Headers, client *http.Client) (r Result) {
-	reqBytes, err := json.Marshal(req)
-	if err != nil {
-		r.Code = FailNow
-		r.Error = errors.Errorf("json fail on: %v", req)
-		return
+	return c.SendContext(context.Background(), url, req, headers, client)
+}
+
+func (c *Config) SendContext(ctx context.Context, url string, req interface{}, headers Headers, client *http.Client) (r Result) {
+	if c.RateLimit != nil {
+		h := headers
+		h.topic = c.Bundle
+		if r, ok := c.RateLimit.wait(ctx, deviceToken(url), h.Map()["apns-topic"], headers.CollapseId); !ok {
+			return r
+		}
 	}
+	if c.Retry != nil {
+		return c.sendWithRetry(ctx, url, req, headers, client)
+	}
+	r = c.send(ctx, url, req, headers, client)
+	r.Attempts = 1
+	return
+}
 
-	maxPayloadSize := 4096
-	if headers.PushType == PushTypeVoip {
-		maxPayloadSize = 5120
+func (c *Config) send(ctx context.Context, url string, req interface{}, headers Headers, client *http.Client) (r Result) {
+	var reqBytes []byte
+	var err error
+	if raw, ok := req.(json.RawMessage); ok {
+		reqBytes = raw
+	} else if reqBytes, err = json.Marshal(req); err != nil {
+		r.Code = FailNow
+		r.Error = errors.Wrap(err, "json fail")
+		return
 	}
 
-	if len(reqBytes) > maxPayloadSize {
+	if c.Validate {
+		if errs := validate(reqBytes, headers); len(errs) > 0 {
+			r.Code = FailNow
+			r.Error = errs
+			return
+		}
+	} else if max := maxPayloadSize(headers.PushType); len(reqBytes) > max {
 		r.Code = FailNow
-		r.Error = errors.Errorf("big json: %v", string(reqBytes))
+		r.Error = errors.Errorf("big json: %d bytes, max %d", len(reqBytes), max)
 		return
 	}
 
-	request, err := http.NewRequest("POST", url, bytes.NewReader(reqBytes))
+	request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBytes))
 	if err != nil {
 		r.Code = RetryNow
 		r.Error = errors.Wrap(err, "post fail")
 		return
 	}
 
-	token, err := c.getToken()
-	if err != nil {
-		r.Code = FailNow
-		r.Error = errors.Wrap(err, "get token fial")
-		return
+	if headers.Id == "" {
+		headers.Id = newUUID()
 	}
+	r.ApnsId = headers.Id
 
 	headers.topic = c.Bundle
 	for k, v := range headers.Map() {
 		request.Header.Set(k, v)
 	}
 
-	request.Header.Set("Authorization", "bearer "+token)
+	var token string
+	if c.usesCert() {
+		if headers.PushType == PushTypeLocation {
+			r.Code = InvalidConfig
+			r.Error = errors.New("location pushes need token authentication")
+			return
+		}
+		cert, err := c.getCert()
+		if err != nil {
+			r.Code = InvalidConfig
+			r.Error = errors.Wrap(err, "get cert fail")
+			return
+		}
+		topic := request.Header.Get("apns-topic")
+		if topic == "" && headers.ChannelId != "" {
+			// broadcasts name the bundle in the path and send no topic
+			topic = c.Bundle
+		}
+		if !cert.allows(topic) {
+			r.Code = InvalidConfig
+			r.Error = errors.Errorf("topic %s is not allowed by certificate", topic)
+			return
+		}
+	} else {
+		token, err = c.getToken(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				r.Code = Canceled
+				r.Error = errors.Wrap(ctx.Err(), "get token fail")
+				return
+			}
+			r.Code = FailNow
+			r.Error = errors.Wrap(err, "get token fial")
+			return
+		}
+		request.Header.Set("Authorization", "bearer "+token)
+	}
+
 	request.Header.Set("Content-Type", "application/json")
 
 	if client == nil {
-		client = http.DefaultClient
+		client, err = c.getClient()
+		if err != nil {
+			r.Code = FailNow
+			r.Error = errors.Wrap(err, "get client fail")
+			return
+		}
 	}
+	start := time.Now()
 	response, err := client.Do(request)
 	if err != nil {
+		if ctx.Err() != nil {
+			r.Code = Canceled
+			r.Error = errors.Wrap(ctx.Err(), "client do fail")
+			return
+		}
 		r.Code = RetryNow
 		r.Error = errors.Wrap(err, "client do fail")
 		return
@@ -94,11 +231,23 @@ func (c *Config) Send(url string, req interface{}, headers Headers, client *http
 
 	body, err := ioutil.ReadAll(response.Body)
 	if err != nil {
+		if ctx.Err() != nil {
+			r.Code = Canceled
+			r.Error = errors.Wrap(ctx.Err(), "read all fail")
+			return
+		}
 		r.Code = RetryNow
 		r.Error = errors.Wrap(err, "read all fail")
 		return
 	}
 
+	r.Latency = time.Since(start)
+	r.StatusCode = response.StatusCode
+	if id := response.Header.Get("apns-id"); id != "" {
+		r.ApnsId = id
+	}
+	r.ApnsUniqueId = response.Header.Get("apns-unique-id")
+
 	r.DebugRequest = fmt.Sprintf("url: %s\n%s", url, string(reqBytes))
 	r.DebugResponse = fmt.Sprintf("code: %d\nbody: %s", response.StatusCode, string(body))
 
@@ -107,41 +256,35 @@ func (c *Config) Send(url string, req interface{}, headers Headers, client *http
 		return
 	}
 
-	if 400 <= response.StatusCode && response.StatusCode <= 499 {
-		data := new(struct {
-			Reason string `json:"reason"`
-		})
-
-		if err := json.Unmarshal(body, data); err != nil {
+	if 400 <= response.StatusCode && response.StatusCode <= 599 {
+		apnsErr, err := parseError(response.StatusCode, r.ApnsId, body)
+		if err != nil {
+			if response.StatusCode >= 500 {
+				r.Code = RetryLater
+				r.Error = fmt.Errorf("5xx")
+				return
+			}
 			r.Code = RetryLater
 			r.Error = errors.Wrap(err, "json error")
 			return
 		}
 
-		switch data.Reason {
-		case "BadDeviceToken", "Unregistered", "TopicDisallowed", "DeviceTokenNotForTopic", "InvalidProviderToken":
-			r.Code = InvalidConfig
-		case "ExpiredProviderToken":
-			c.resetToken()
-			r.Code = RetryNow
-		case "TooManyRequests":
-			r.Code = RetryLater
-		case "TooManyProviderTokenUpdates":
-			c.resetToken()
+		r.Code = apnsErr.Code
+		r.Error = apnsErr
+
+		// Not for TooManyProviderTokenUpdates: the current token is still valid there, signing a new one
+		// would only make it worse. If the token was signed less than minTokenRefresh ago, an immediate
+		// retry would send it again.
+		if apnsErr.Reason == ExpiredProviderToken && !c.resetToken(ctx, token) {
 			r.Code = RetryLater
-		case "MissingProviderToken":
-			r.Code = FailNow
-		default:
-			r.Code = FailNow
 		}
 
-		r.Error = fmt.Errorf(data.Reason)
-		return
-	}
-
-	if 500 <= response.StatusCode && response.StatusCode <= 599 {
-		r.Code = RetryLater
-		r.Error = fmt.Errorf("5xx")
+		if r.Code == InvalidToken && headers.ChannelId == "" {
+			r.InvalidSince = apnsErr.Timestamp
+			if c.OnInvalidToken != nil {
+				c.OnInvalidToken(deviceToken(url), apnsErr.Reason, apnsErr.Timestamp)
+			}
+		}
 		return
 	}
 
@@ -150,53 +293,156 @@ func (c *Config) Send(url string, req interface{}, headers Headers, client *http
 	return
 }
 
-func (c *Config) resetToken() {
+// resetToken drops token after APNs answered ExpiredProviderToken. It reports whether the next send gets
+// another token, false if this process signed token less than minTokenRefresh ago and has to keep it.
+func (c *Config) resetToken(ctx context.Context, token string) bool {
+	c.tokenMux.Lock()
+	defer c.tokenMux.Unlock()
+
+	// a concurrent send could have refreshed it already
+	if c.tokenValue == nil || *c.tokenValue != token {
+		return true
+	}
+
 	log.Println("apns: reset token")
 	c.generated = nil
+
+	if c.TokenStore != nil {
+		if err := c.TokenStore.Delete(ctx, c.tokenKey(), token); err != nil {
+			log.Println("apns: token store delete fail:", err)
+		}
+	}
+	return c.signed == nil || time.Since(*c.signed) >= minTokenRefresh
+}
+
+func (c *Config) getToken(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	c.tokenMux.Lock()
+	defer c.tokenMux.Unlock()
+
+	return c.getTokenLocked(ctx, tokenLifetime)
+}
+
+// getTokenLocked returns the current token, or a new one if the current is older than maxAge.
+func (c *Config) getTokenLocked(ctx context.Context, maxAge time.Duration) (string, error) {
+	if c.generated != nil && time.Since(*c.generated) <= maxAge {
+		return *c.tokenValue, nil
+	}
+
+	// APNs answers TooManyProviderTokenUpdates if the token is refreshed more often than this
+	if c.signed != nil && time.Since(*c.signed) < minTokenRefresh {
+		return *c.tokenValue, nil
+	}
+
+	if c.TokenStore != nil {
+		val, err := c.getSharedTokenLocked(ctx, maxAge)
+		if err == nil {
+			return val, nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+		log.Println("apns: token store fail, signing own token:", err)
+	}
+
+	return c.newTokenLocked(ctx)
 }
 
-func (c *Config) getToken() (string, error) {
-	c.mux.Lock()
-	defer c.mux.Unlock()
+// tokenKey identifies the provider token in a TokenStore.
+func (c *Config) tokenKey() string {
+	return "apns-" + c.TeamId + "-" + c.KeyId
+}
+
+func (c *Config) getSharedTokenLocked(ctx context.Context, maxAge time.Duration) (string, error) {
+	key := c.tokenKey()
+
+	if ok, err := c.loadTokenLocked(ctx, key, maxAge); err != nil {
+		return "", err
+	} else if ok {
+		return *c.tokenValue, nil
+	}
+
+	unlock, err := c.TokenStore.Lock(ctx, key)
+	if err != nil {
+		return "", errors.Wrap(err, "token store lock fail")
+	}
+	defer unlock()
+
+	// another process could have refreshed it while we were waiting for the lock
+	if ok, err := c.loadTokenLocked(ctx, key, maxAge); err != nil {
+		return "", err
+	} else if ok {
+		return *c.tokenValue, nil
+	}
 
-	if c.generated == nil || time.Since(*c.generated) > 59*time.Minute {
-		ts := time.Now()
-		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
-			"iss": c.TeamId,
-			"iat": ts.Unix(),
-		})
-		token.Header["kid"] = c.KeyId
+	val, err := c.newTokenLocked(ctx)
+	if err != nil {
+		return "", err
+	}
 
+	ttl := tokenLifetime - time.Since(*c.generated)
+	if err := c.TokenStore.Set(ctx, key, StoredToken{Value: val, Issued: *c.generated}, ttl); err != nil {
+		log.Println("apns: token store set fail:", err)
+	}
+	return val, nil
+}
+
+func (c *Config) loadTokenLocked(ctx context.Context, key string, maxAge time.Duration) (bool, error) {
+	v, err := c.TokenStore.Get(ctx, key)
+	if err != nil {
+		return false, errors.Wrap(err, "token store get fail")
+	}
+	if v == nil || time.Since(v.Issued) > maxAge {
+		return false, nil
+	}
+	c.tokenValue = &v.Value
+	c.generated = &v.Issued
+	return true, nil
+}
+
+func (c *Config) newTokenLocked(ctx context.Context) (string, error) {
+	// backdated a little, so a clock running ahead of Apple's does not produce a token from the future
+	ts := time.Now().Add(-tokenClockSkew)
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": c.TeamId,
+		"iat": ts.Unix(),
+	})
+	token.Header["kid"] = c.KeyId
+
+	var val string
+	if signer := c.getTokenSigner(); signer != nil {
+		v, err := signToken(ctx, token, signer)
+		if err != nil {
+			return "", errors.Wrap(err, "token signing fail")
+		}
+		val = v
+	} else {
 		key, err := c.getAuthKey()
 		if err != nil {
 			return "", err
 		}
-
-		val, err := token.SignedString(key)
+		v, err := token.SignedString(key)
 		if err != nil {
 			return "", errors.Wrap(err, "token signing fail")
 		}
-
-		c.tokenValue = &val
-		c.generated = &ts
+		val = v
 	}
 
-	return *c.tokenValue, nil
+	now := time.Now()
+	c.tokenValue = &val
+	c.generated = &ts
+	c.signed = &now
+	return val, nil
 }
 
 func (c *Config) getAuthKey() (*ecdsa.PrivateKey, error) {
 	if c.authKey == nil {
-		block, _ := pem.Decode(c.AuthKey)
-		if block == nil {
-			return nil, fmt.Errorf("pem decode error")
-		}
-		pKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		pkey, err := parseAuthKey(c.AuthKey)
 		if err != nil {
-			return nil, errors.Wrap(err, "p8 parse error")
-		}
-		pkey, ok := pKey.(*ecdsa.PrivateKey)
-		if !ok {
-			return nil, fmt.Errorf("not ECDSA private key")
+			return nil, err
 		}
 		c.authKey = pkey
 	}
@@ -206,16 +452,11 @@ func (c *Config) getAuthKey() (*ecdsa.PrivateKey, error) {
 func (c *Config) getSafariClient() (*http.Client, error) {
 	if c.safariClient == nil {
 		// https://support.airship.com/hc/en-us/articles/360017992631-How-to-make-an-Apple-Safari-Web-Push-certificate
-		key, cert, err := pkcs12.Decode(c.SafariCert, "")
+		cert, err := loadCert(c.SafariCert, nil, c.SafariCertPassword)
 		if err != nil {
-			return nil, errors.Wrap(err, "pkcs12.Decode")
-		}
-		tlsCert := tls.Certificate{
-			Certificate: [][]byte{cert.Raw},
-			PrivateKey:  key.(*rsa.PrivateKey),
-			Leaf:        cert,
+			return nil, err
 		}
-		tlsCfg := &tls.Config{Certificates: []tls.Certificate{tlsCert}}
+		tlsCfg := &tls.Config{Certificates: []tls.Certificate{cert.tls}}
 		tlsCfg.BuildNameToCertificate()
 		transport := &http.Transport{TLSClientConfig: tlsCfg}
 		if err := http2.ConfigureTransport(transport); err != nil {
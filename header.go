@@ -37,6 +37,30 @@ const (
 	// Use the mdm push type for notifications that tell managed devices to contact the MDM server. If you set
 	// this push type, you must use the topic from the UID attribute in the subject of your MDM push certificate.
 	PushTypeMdm = PushType("mdm")
+
+	// Use the liveactivity push type for notifications that start, update or end a Live Activity. If you set
+	// this push type, the apns-topic header field must use your app’s bundle ID with .push-type.liveactivity
+	// appended to the end.
+	PushTypeLiveActivity = PushType("liveactivity")
+
+	// Use the location push type for notifications that request a user’s location. If you set this push type,
+	// the apns-topic header field must use your app’s bundle ID with .location-query appended to the end.
+	// Location pushes are only supported with token-based authentication and use priority 10 or 5.
+	PushTypeLocation = PushType("location")
+
+	// Use the pushtotalk push type for notifications that provide information about an incoming Push to Talk
+	// (PTT) audio transmission. If you set this push type, the apns-topic header field must use your app’s
+	// bundle ID with .voip-ptt appended to the end. Push to Talk pushes are delivered immediately: use
+	// priority 10 and no expiration.
+	PushTypePushToTalk = PushType("pushtotalk")
+
+	// Use the widgets push type for notifications that trigger a widget reload. If you set this push type,
+	// the apns-topic header field must use your app’s bundle ID with .push-type.widgets appended to the end.
+	PushTypeWidgets = PushType("widgets")
+
+	// Use the controls push type for notifications that trigger a control reload. If you set this push type,
+	// the apns-topic header field must use your app’s bundle ID with .push-type.controls appended to the end.
+	PushTypeControls = PushType("controls")
 )
 
 type Headers struct {
@@ -49,8 +73,8 @@ type Headers struct {
 	// A canonical UUID that is the unique ID for the notification. If an error occurs when sending the notification,
 	// APNs includes this value when reporting the error to your server. Canonical UUIDs are 32 lowercase hexadecimal
 	// digits, displayed in five groups separated by hyphens in the form 8-4-4-4-12. An example looks like this:
-	// 123e4567-e89b-12d3-a456-4266554400a0. If you omit this header, APNs creates a UUID for you and returns it
-	// in its response.
+	// 123e4567-e89b-12d3-a456-4266554400a0. If you leave it empty, Config.Send generates one and returns it
+	// in Result.ApnsId.
 	Id string
 
 	// The date at which the notification is no longer valid. This value is a UNIX epoch expressed in seconds (UTC).
@@ -75,10 +99,31 @@ type Headers struct {
 	CollapseId string
 
 	// The topic for the notification. In general, the topic is your app’s bundle ID, but it may have a suffix
-	// based on the push notification’s type.
+	// based on the push notification’s type. Leave it empty to use the Config bundle with the suffix of
+	// PushType appended. Set it for pushes whose topic is not derived from the bundle: MDM pushes (the UID
+	// from the push certificate), Safari pushes (the website push ID) or app extensions with their own
+	// bundle ID. An explicit topic is sent as is, without a suffix. Not sent with broadcasts.
+	Topic string
+
+	// The broadcast channel of a Live Activity broadcast push, as returned by Config.CreateChannel. Set by
+	// Config.Broadcast; broadcast pushes carry no topic.
+	ChannelId string
+
+	// The default topic, set by Config.Send to the Config bundle.
 	topic string
 }
 
+// pushHeaders returns a copy of h, or empty Headers if h is nil, with PushType set to t. Pushes never
+// change the Headers they are given, so one value can be reused for pushes of several types.
+func pushHeaders(h *Headers, t PushType) Headers {
+	var res Headers
+	if h != nil {
+		res = *h
+	}
+	res.PushType = t
+	return res
+}
+
 func (h Headers) Map() map[string]string {
 	res := make(map[string]string)
 
@@ -97,12 +142,21 @@ func (h Headers) Map() map[string]string {
 	if h.Priority > 0 {
 		res["apns-priority"] = fmt.Sprintf("%d", h.Priority)
 	}
-	
+
 	if h.CollapseId != "" {
 		res["apns-collapse-id"] = h.CollapseId
 	}
 
-	if h.topic != "" {
+	if h.ChannelId != "" {
+		res["apns-channel-id"] = h.ChannelId
+	}
+
+	switch {
+	case h.ChannelId != "":
+		// broadcasts carry the bundle in the path and send no topic
+	case h.Topic != "":
+		res["apns-topic"] = h.Topic
+	case h.topic != "":
 		res["apns-topic"] = h.topic
 		switch h.PushType {
 		case PushTypeVoip:
@@ -111,6 +165,16 @@ func (h Headers) Map() map[string]string {
 			res["apns-topic"] += ".complication"
 		case PushTypeFileprovider:
 			res["apns-topic"] += ".pushkit.fileprovider"
+		case PushTypeLiveActivity:
+			res["apns-topic"] += ".push-type.liveactivity"
+		case PushTypeLocation:
+			res["apns-topic"] += ".location-query"
+		case PushTypePushToTalk:
+			res["apns-topic"] += ".voip-ptt"
+		case PushTypeWidgets:
+			res["apns-topic"] += ".push-type.widgets"
+		case PushTypeControls:
+			res["apns-topic"] += ".push-type.controls"
 		}
 	}
 
@@ -0,0 +1,24 @@
+package apns
+
+import "testing"
+
+func TestHeadersTopic(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		h    Headers
+		want string
+	}{
+		{name: "default", h: Headers{topic: "com.example.app"}, want: "com.example.app"},
+		{name: "suffix", h: Headers{topic: "com.example.app", PushType: PushTypeVoip}, want: "com.example.app.voip"},
+		{name: "explicit", h: Headers{topic: "com.example.app", Topic: "com.example.ext", PushType: PushTypeVoip}, want: "com.example.ext"},
+		{name: "broadcast", h: Headers{topic: "com.example.app", ChannelId: "ch", PushType: PushTypeLiveActivity}},
+		{name: "broadcast with topic", h: Headers{topic: "com.example.app", Topic: "com.example.app", ChannelId: "ch"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			topic, ok := tt.h.Map()["apns-topic"]
+			if topic != tt.want || ok != (tt.want != "") {
+				t.Errorf("apns-topic: got %q, want %q", topic, tt.want)
+			}
+		})
+	}
+}
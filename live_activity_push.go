@@ -0,0 +1,97 @@
+package apns
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// LiveActivityEvent is the action of a Live Activity push.
+type LiveActivityEvent string
+
+const (
+	// Starts a Live Activity. Sent to the push-to-start token of the app.
+	LiveActivityStart = LiveActivityEvent("start")
+
+	// Updates a running Live Activity. Sent to the push token of the activity.
+	LiveActivityUpdate = LiveActivityEvent("update")
+
+	// Ends a Live Activity. Sent to the push token of the activity.
+	LiveActivityEnd = LiveActivityEvent("end")
+)
+
+// LiveActivityPush starts, updates or ends a Live Activity.
+type LiveActivityPush struct {
+	// The push token of the activity for update and end events, or the push-to-start token of the app for
+	// start events.
+	Token string
+
+	Event LiveActivityEvent
+
+	// When the update was generated. Defaults to now. The system drops an update older than the one it shows,
+	// so set it from the state the update was built from when updates may be sent out of order.
+	Timestamp time.Time
+
+	// The dynamic content of the activity, marshalled to JSON. Required for start and update events.
+	ContentState interface{}
+
+	// Optional. When the activity becomes outdated.
+	StaleDate time.Time
+
+	// Optional, end events only. When the ended activity is removed from the Lock Screen. A time in the past
+	// removes it immediately.
+	DismissalDate time.Time
+
+	// Start events only. The name and value of the ActivityAttributes type in your app.
+	AttributesType string
+	Attributes     interface{}
+
+	// An alert shown with the update. Required for start events.
+	Title string
+	Body  string
+	Sound string
+}
+
+func (p LiveActivityPush) timestamp() time.Time {
+	if p.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return p.Timestamp
+}
+
+// Payload builds the notification payload.
+func (p LiveActivityPush) Payload() *Payload {
+	res := NewPayload()
+	res.Aps.Event = p.Event
+	res.Aps.Timestamp = p.timestamp().Unix()
+	res.Aps.ContentState = p.ContentState
+	res.Aps.AttributesType = p.AttributesType
+	res.Aps.Attributes = p.Attributes
+	if !p.StaleDate.IsZero() {
+		res.Aps.StaleDate = p.StaleDate.Unix()
+	}
+	if !p.DismissalDate.IsZero() {
+		res.Aps.DismissalDate = p.DismissalDate.Unix()
+	}
+	if p.Title != "" || p.Body != "" {
+		res.AlertTitle(p.Title).AlertBody(p.Body)
+	}
+	if p.Sound != "" {
+		res.Sound(p.Sound)
+	}
+	return res
+}
+
+// Validate checks the push with Validate.
+func (p LiveActivityPush) Validate(h *Headers) error {
+	return Validate(p.Payload(), pushHeaders(h, PushTypeLiveActivity))
+}
+
+func (p LiveActivityPush) Send(c *Config, h *Headers) (r Result) {
+	return p.SendContext(context.Background(), c, h)
+}
+
+func (p LiveActivityPush) SendContext(ctx context.Context, c *Config, h *Headers) (r Result) {
+	url := fmt.Sprintf(urlMask, c.Host, p.Token)
+	return c.SendContext(ctx, url, p.Payload(), pushHeaders(h, PushTypeLiveActivity), nil)
+}
@@ -0,0 +1,28 @@
+package apns
+
+import (
+	"context"
+	"fmt"
+)
+
+// LocationPush asks the Location Push Service Extension of the app for the location of the device.
+// The payload carries no alert; Data is passed to the extension. Location pushes need token-based
+// authentication.
+type LocationPush struct {
+	Data  map[string]interface{}
+	Token string
+}
+
+// Payload builds the notification payload.
+func (p LocationPush) Payload() *Payload {
+	return NewPayload().CustomData(p.Data)
+}
+
+func (p LocationPush) Send(c *Config, h *Headers) (r Result) {
+	return p.SendContext(context.Background(), c, h)
+}
+
+func (p LocationPush) SendContext(ctx context.Context, c *Config, h *Headers) (r Result) {
+	url := fmt.Sprintf(urlMask, c.Host, p.Token)
+	return c.SendContext(ctx, url, p.Payload(), pushHeaders(h, PushTypeLocation), nil)
+}
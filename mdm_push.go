@@ -0,0 +1,51 @@
+package apns
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// MdmPush tells a managed device to contact its MDM server. It needs a Config with the MDM push
+// certificate in Cert; the topic is the UID of the certificate subject.
+type MdmPush struct {
+	// The PushMagic string the device sent in its TokenUpdate check-in message.
+	PushMagic string
+
+	// The device token from the TokenUpdate message, hex-encoded. The message carries it as raw bytes.
+	Token string
+}
+
+// Payload builds the notification payload. MDM pushes carry no aps dictionary.
+func (p MdmPush) Payload() map[string]string {
+	return map[string]string{"mdm": p.PushMagic}
+}
+
+func (p MdmPush) Send(c *Config, h *Headers) (r Result) {
+	return p.SendContext(context.Background(), c, h)
+}
+
+func (p MdmPush) SendContext(ctx context.Context, c *Config, h *Headers) (r Result) {
+	if !c.usesCert() {
+		r.Code = InvalidConfig
+		r.Error = errors.New("mdm pushes need certificate authentication")
+		return
+	}
+	cert, err := c.getCert()
+	if err != nil {
+		r.Code = InvalidConfig
+		r.Error = errors.Wrap(err, "get cert fail")
+		return
+	}
+	if cert.uid == "" {
+		r.Code = InvalidConfig
+		r.Error = errors.New("no uid in mdm certificate")
+		return
+	}
+
+	url := fmt.Sprintf(urlMask, c.Host, p.Token)
+	hh := pushHeaders(h, PushTypeMdm)
+	hh.Topic = cert.uid
+	return c.SendContext(ctx, url, p.Payload(), hh, nil)
+}
@@ -0,0 +1,108 @@
+package apns_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/tada-team/apns"
+	"github.com/tada-team/apns/apnstest"
+)
+
+// mdmCert returns a self-signed PEM certificate and key; uid is the subject UID, if any.
+func mdmCert(t *testing.T, uid string) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := pkix.Name{CommonName: "APSP:test"}
+	if uid != "" {
+		subject.ExtraNames = []pkix.AttributeTypeAndValue{
+			{Type: asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}, Value: uid},
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &x509.Certificate{Subject: subject}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return append(res, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})...)
+}
+
+func TestMdmPush(t *testing.T) {
+	const uid = "com.apple.mgmt.External.0c9c6d4b-3e5a-4c4c-9f5e-3c0f2d7c1a11"
+
+	for _, tt := range []struct {
+		name     string
+		cert     []byte
+		wantCode apns.ResultCode
+	}{
+		{name: "uid topic", cert: mdmCert(t, uid), wantCode: apns.Ok},
+		{name: "no uid", cert: mdmCert(t, ""), wantCode: apns.InvalidConfig},
+		{name: "token only", wantCode: apns.InvalidConfig},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var c *apns.Config
+			var srv *apnstest.Server
+			if tt.cert != nil {
+				c = &apns.Config{Cert: tt.cert}
+				srv = apnstest.NewServer()
+				srv.Configure(c)
+				t.Cleanup(func() {
+					c.Close()
+					srv.Close()
+				})
+			} else {
+				c, srv = newTestConfig(t)
+			}
+
+			h := &apns.Headers{Priority: 10}
+			r := apns.MdmPush{PushMagic: "magic", Token: testToken}.SendContext(context.Background(), c, h)
+			if r.Code != tt.wantCode {
+				t.Fatalf("code: got %v, want %v (%v)", r.Code, tt.wantCode, r.Error)
+			}
+			if h.Topic != "" || h.PushType != "" {
+				t.Errorf("headers changed: %+v", *h)
+			}
+
+			reqs := srv.Requests()
+			if tt.wantCode != apns.Ok {
+				if len(reqs) != 0 {
+					t.Errorf("requests: got %d, want 0", len(reqs))
+				}
+				return
+			}
+			if len(reqs) != 1 {
+				t.Fatalf("requests: got %d, want 1", len(reqs))
+			}
+			req := reqs[0]
+			if req.Topic != uid || req.PushType != "mdm" || string(req.Body) != `{"mdm":"magic"}` {
+				t.Errorf("request: topic %s, push type %s, body %s", req.Topic, req.PushType, req.Body)
+			}
+			if req.Cert == nil || req.Cert.Subject.CommonName != "APSP:test" {
+				t.Error("no client certificate")
+			}
+		})
+	}
+}
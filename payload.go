@@ -0,0 +1,211 @@
+package apns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Payload is the JSON body of a notification: the aps dictionary plus custom top-level keys.
+// Setters return the payload, so calls can be chained:
+//
+//	p := NewPayload().AlertTitle("Hi").AlertBody("New message").Sound("default").Custom("chat", id)
+type Payload struct {
+	Aps Aps
+
+	// Custom keys sent next to aps. An "aps" key here is ignored.
+	Data map[string]interface{}
+}
+
+func NewPayload() *Payload {
+	return new(Payload)
+}
+
+func (p Payload) MarshalJSON() ([]byte, error) {
+	res := make(map[string]interface{}, len(p.Data)+1)
+	for k, v := range p.Data {
+		res[k] = v
+	}
+	res["aps"] = p.Aps
+	return json.Marshal(res)
+}
+
+func (p *Payload) alert() *Alert {
+	if p.Aps.Alert == nil {
+		p.Aps.Alert = new(Alert)
+	}
+	return p.Aps.Alert
+}
+
+func (p *Payload) AlertTitle(v string) *Payload {
+	p.alert().Title = v
+	return p
+}
+
+func (p *Payload) AlertSubtitle(v string) *Payload {
+	p.alert().Subtitle = v
+	return p
+}
+
+func (p *Payload) AlertBody(v string) *Payload {
+	p.alert().Body = v
+	return p
+}
+
+// AlertAction sets the label of the action button. Safari only.
+func (p *Payload) AlertAction(v string) *Payload {
+	p.alert().Action = v
+	return p
+}
+
+func (p *Payload) AlertLaunchImage(v string) *Payload {
+	p.alert().LaunchImage = v
+	return p
+}
+
+func (p *Payload) AlertTitleLoc(key string, args ...string) *Payload {
+	p.alert().TitleLocKey = key
+	if len(args) > 0 {
+		p.alert().TitleLocArgs = &args
+	}
+	return p
+}
+
+func (p *Payload) AlertSubtitleLoc(key string, args ...string) *Payload {
+	p.alert().SubtitleLocKey = key
+	if len(args) > 0 {
+		p.alert().SubtitleLocArgs = &args
+	}
+	return p
+}
+
+func (p *Payload) AlertLoc(key string, args ...string) *Payload {
+	p.alert().LocKey = key
+	if len(args) > 0 {
+		p.alert().LocArgs = &args
+	}
+	return p
+}
+
+func (p *Payload) AlertActionLocKey(v string) *Payload {
+	p.alert().ActionLocKey = v
+	return p
+}
+
+// Badge sets the badge number. Use 0 to remove the badge.
+func (p *Payload) Badge(v int) *Payload {
+	p.Aps.Badge = &v
+	return p
+}
+
+// Sound sets the sound file name; "default" plays the system sound and an empty name removes the sound.
+func (p *Payload) Sound(v string) *Payload {
+	if v == "" {
+		p.Aps.Sound = nil
+	} else {
+		p.Aps.Sound = v
+	}
+	return p
+}
+
+// CriticalSound sets the sound of a critical alert. volume is from 0 (silent) to 1 (full volume).
+func (p *Payload) CriticalSound(name string, volume float64) *Payload {
+	p.Aps.Sound = &CriticalSound{Critical: 1, Name: name, Volume: &volume}
+	return p
+}
+
+func (p *Payload) InterruptionLevel(v InterruptionLevel) *Payload {
+	p.Aps.InterruptionLevel = v
+	return p
+}
+
+// RelevanceScore sets the score, from 0 to 1, used to sort the notifications in the summary.
+func (p *Payload) RelevanceScore(v float64) *Payload {
+	p.Aps.RelevanceScore = &v
+	return p
+}
+
+func (p *Payload) FilterCriteria(v string) *Payload {
+	p.Aps.FilterCriteria = v
+	return p
+}
+
+func (p *Payload) ThreadId(v string) *Payload {
+	p.Aps.ThreadId = v
+	return p
+}
+
+func (p *Payload) Category(v string) *Payload {
+	p.Aps.Category = v
+	return p
+}
+
+// ContentAvailable marks the payload as a background update.
+func (p *Payload) ContentAvailable() *Payload {
+	p.Aps.ContentAvailable = 1
+	return p
+}
+
+// MutableContent passes the notification to the notification service app extension before delivery.
+func (p *Payload) MutableContent() *Payload {
+	p.Aps.MutableContent = 1
+	return p
+}
+
+// ContentChanged asks the system to reload the widgets or controls of the app. For widgets and controls
+// push types.
+func (p *Payload) ContentChanged() *Payload {
+	p.Aps.ContentChanged = true
+	return p
+}
+
+func (p *Payload) TargetContentId(v string) *Payload {
+	p.Aps.TargetContentId = v
+	return p
+}
+
+// UrlArgs sets the url-args key. Safari only; the key is sent even without arguments.
+func (p *Payload) UrlArgs(args ...string) *Payload {
+	if args == nil {
+		args = []string{}
+	}
+	p.Aps.UrlArgs = &args
+	return p
+}
+
+// Custom sets a custom top-level key.
+func (p *Payload) Custom(key string, value interface{}) *Payload {
+	if p.Data == nil {
+		p.Data = make(map[string]interface{})
+	}
+	p.Data[key] = value
+	return p
+}
+
+// CustomData sets several custom top-level keys.
+func (p *Payload) CustomData(data map[string]interface{}) *Payload {
+	for k, v := range data {
+		p.Custom(k, v)
+	}
+	return p
+}
+
+// SendPayload sends a payload to a device token. If h.PushType is empty it is set to liveactivity for
+// payloads with an event, to background for content-available payloads without an alert, sound or badge,
+// and to alert otherwise.
+func (c *Config) SendPayload(ctx context.Context, token string, p *Payload, h Headers) Result {
+	if h.PushType == "" {
+		h.PushType = p.pushType()
+	}
+	return c.SendContext(ctx, fmt.Sprintf(urlMask, c.Host, token), p, h, nil)
+}
+
+func (p *Payload) pushType() PushType {
+	if p.Aps.Event != "" {
+		return PushTypeLiveActivity
+	}
+	if p.Aps.ContentAvailable == 1 && p.Aps.Alert == nil && p.Aps.Sound == nil && p.Aps.Badge == nil {
+		return PushTypeBackground
+	}
+	return PushTypeAlert
+}
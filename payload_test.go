@@ -0,0 +1,40 @@
+package apns
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCriticalSoundVolume(t *testing.T) {
+	zero, half := 0.0, 0.5
+
+	for _, tt := range []struct {
+		name    string
+		payload *Payload
+		want    string
+	}{
+		{name: "payload silent", payload: NewPayload().CriticalSound("alarm.caf", 0), want: `{"critical":1,"name":"alarm.caf","volume":0}`},
+		{name: "payload half", payload: NewPayload().CriticalSound("alarm.caf", 0.5), want: `{"critical":1,"name":"alarm.caf","volume":0.5}`},
+		{name: "push default volume", payload: AlertPush{InterruptionLevel: InterruptionCritical}.Payload(), want: `{"critical":1,"name":"default"}`},
+		{name: "push silent", payload: AlertPush{InterruptionLevel: InterruptionCritical, SoundVolume: &zero}.Payload(), want: `{"critical":1,"name":"default","volume":0}`},
+		{name: "push half", payload: AlertPush{InterruptionLevel: InterruptionCritical, Sound: "alarm.caf", SoundVolume: &half}.Payload(), want: `{"critical":1,"name":"alarm.caf","volume":0.5}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var v struct {
+				Aps struct {
+					Sound json.RawMessage `json:"sound"`
+				} `json:"aps"`
+			}
+			if err := json.Unmarshal(b, &v); err != nil {
+				t.Fatal(err)
+			}
+			if string(v.Aps.Sound) != tt.want {
+				t.Errorf("sound: got %s, want %s", v.Aps.Sound, tt.want)
+			}
+		})
+	}
+}
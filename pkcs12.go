@@ -0,0 +1,46 @@
+package apns
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// decodePKCS12 returns the private key from a .p12 file, the certificate
+// matching it and the rest of the certificate chain. Both the legacy encoding
+// Keychain Access used to export and the SHA-256 MAC with PBES2 (PBKDF2 + AES)
+// bags written by OpenSSL 3 and recent macOS are understood.
+func decodePKCS12(data []byte, password string) (crypto.PrivateKey, *x509.Certificate, []*x509.Certificate, error) {
+	key, first, rest, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "pkcs12 decode fail")
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, errors.New("pkcs12: unsupported private key type")
+	}
+	pub, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "pkcs12: public key")
+	}
+
+	// DecodeChain takes the first certificate for the leaf, but nothing orders the bags
+	var leaf *x509.Certificate
+	var chain []*x509.Certificate
+	for _, cert := range append([]*x509.Certificate{first}, rest...) {
+		if leaf == nil && bytes.Equal(cert.RawSubjectPublicKeyInfo, pub) {
+			leaf = cert
+			continue
+		}
+		chain = append(chain, cert)
+	}
+	if leaf == nil {
+		return nil, nil, nil, errors.New("pkcs12: no certificate matches the private key")
+	}
+
+	return key, leaf, chain, nil
+}
@@ -0,0 +1,104 @@
+package apns
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// The fixtures are written by testdata/gen_p12.sh: a leaf certificate for com.example.app signed by
+// "Test CA", both in every file.
+func TestDecodePKCS12(t *testing.T) {
+	for _, tt := range []struct {
+		file        string
+		password    string
+		wantErr     error
+		unsupported bool // not written by Keychain Access or OpenSSL by default
+	}{
+		{file: "p12_aes_sha256.p12", password: "test"},
+		{file: "p12_aes_sha384.p12", password: "test", unsupported: true},
+		{file: "p12_aes_sha512.p12", password: "test", unsupported: true},
+		{file: "p12_des3_pbes2.p12", password: "test", unsupported: true},
+		{file: "p12_empty_password.p12", password: ""},
+		{file: "p12_legacy.p12", password: "test"},
+		{file: "p12_plain_certs.p12", password: "test"},
+		{file: "p12_aes_sha256.p12", password: "wrong", wantErr: pkcs12.ErrIncorrectPassword},
+		{file: "p12_aes_sha256.p12", password: "", wantErr: pkcs12.ErrIncorrectPassword},
+		{file: "p12_empty_password.p12", password: "test", wantErr: pkcs12.ErrIncorrectPassword},
+		{file: "p12_legacy.p12", password: "wrong", wantErr: pkcs12.ErrIncorrectPassword},
+	} {
+		t.Run(tt.file+"/"+tt.password, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			key, leaf, chain, err := decodePKCS12(data, tt.password)
+			if tt.unsupported {
+				if err == nil {
+					t.Fatal("decoded")
+				}
+				return
+			}
+			if tt.wantErr != nil {
+				if errors.Cause(err) != tt.wantErr {
+					t.Fatalf("err: got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkP12(t, key, leaf.Subject.CommonName, chain)
+		})
+	}
+}
+
+func checkP12(t *testing.T, key interface{}, leafName string, chain []*x509.Certificate) {
+	t.Helper()
+
+	if key == nil {
+		t.Error("no key")
+	}
+	if leafName != "Apple Push Services: com.example.app" {
+		t.Errorf("leaf: got %q", leafName)
+	}
+	if len(chain) != 1 || chain[0].Subject.CommonName != "Test CA" {
+		t.Errorf("chain: got %d certificates", len(chain))
+	}
+}
+
+// A file with the CA bag before the leaf: decodePKCS12 must still pick the certificate matching the key.
+func TestDecodePKCS12CAFirst(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "p12_aes_sha256.p12"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, leaf, chain, err := decodePKCS12(data, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = pkcs12.Encode(rand.Reader, key, chain[0], []*x509.Certificate{leaf}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, first, _, err := pkcs12.DecodeChain(data, "test"); err != nil || first.Subject.CommonName != "Test CA" {
+		t.Fatalf("CA bag is not first: %v", err)
+	}
+
+	key, leaf, chain, err = decodePKCS12(data, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkP12(t, key, leaf.Subject.CommonName, chain)
+
+	if _, err := loadCert(data, nil, "test"); err != nil {
+		t.Fatal(err)
+	}
+}
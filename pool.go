@@ -0,0 +1,350 @@
+package apns
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+)
+
+// connPool is an http.RoundTripper that spreads requests over a fixed number
+// of HTTP/2 connections to a single APNs host.
+type connPool struct {
+	addr      string
+	opts      TransportOpts
+	tlsConfig *tls.Config
+	transport *http2.Transport
+
+	mux     sync.Mutex
+	conns   []*poolConn
+	dialing int
+	closed  bool
+	// closed and replaced every time a stream is released or a connection is dropped
+	wait chan struct{}
+}
+
+type poolConn struct {
+	cc       *http2.ClientConn
+	streams  int
+	lastUsed time.Time
+	idle     *time.Timer
+
+	// removed from the pool, closed once its last stream is released
+	dropped bool
+}
+
+func newConnPool(addr string, opts TransportOpts, tlsConfig *tls.Config) *connPool {
+	return &connPool{
+		addr:      addr,
+		opts:      opts,
+		tlsConfig: tlsConfig,
+		transport: &http2.Transport{
+			TLSClientConfig: tlsConfig,
+			ReadIdleTimeout: opts.PingInterval,
+			// a connection at the server stream limit waits for a free stream instead of
+			// reporting it can't take requests, which would look like a dead connection
+			StrictMaxConcurrentStreams: true,
+			PingTimeout:                opts.pingTimeout(),
+		},
+		wait: make(chan struct{}),
+	}
+}
+
+var errDeadConn = errors.New("connection closed or received GOAWAY")
+
+func (p *connPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	pc, err := p.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := pc.cc.RoundTrip(req)
+	if err != nil {
+		p.release(pc)
+		return nil, err
+	}
+
+	resp.Body = &poolBody{ReadCloser: resp.Body, release: func() { p.release(pc) }}
+	return resp, nil
+}
+
+func (p *connPool) acquire(ctx context.Context) (*poolConn, error) {
+	for {
+		p.mux.Lock()
+		if p.closed {
+			p.mux.Unlock()
+			return nil, errors.New("connection pool closed")
+		}
+
+		dropped := p.dropDeadLocked()
+
+		pc := p.pickLocked()
+		canDial := len(p.conns)+p.dialing < p.opts.connections()
+
+		if pc != nil && (pc.streams == 0 || !canDial) {
+			stale := p.opts.PingInterval > 0 && pc.streams == 0 && time.Since(pc.lastUsed) > p.opts.PingInterval
+			p.useLocked(pc)
+			p.mux.Unlock()
+			p.reportDead(dropped, errDeadConn)
+
+			if stale {
+				if err := p.ping(ctx, pc); err != nil {
+					if ctx.Err() != nil {
+						p.release(pc)
+						return nil, ctx.Err()
+					}
+					p.mux.Lock()
+					pc.streams--
+					p.removeLocked(pc)
+					p.mux.Unlock()
+					pc.cc.Close()
+					p.reportDead(1, errors.Wrap(err, "ping fail"))
+					continue
+				}
+			}
+			return pc, nil
+		}
+
+		if canDial {
+			p.dialing++
+			p.mux.Unlock()
+			p.reportDead(dropped, errDeadConn)
+
+			pc, err := p.dial(ctx)
+
+			p.mux.Lock()
+			p.dialing--
+			if err != nil {
+				p.notifyLocked()
+				p.mux.Unlock()
+				return nil, err
+			}
+			if p.closed {
+				p.mux.Unlock()
+				pc.cc.Close()
+				return nil, errors.New("connection pool closed")
+			}
+			p.conns = append(p.conns, pc)
+			p.useLocked(pc)
+			p.mux.Unlock()
+			return pc, nil
+		}
+
+		wait := p.wait
+		p.mux.Unlock()
+		p.reportDead(dropped, errDeadConn)
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// pickLocked returns the least loaded connection that still has a free stream.
+func (p *connPool) pickLocked() *poolConn {
+	var best *poolConn
+	for _, pc := range p.conns {
+		if max := p.opts.MaxStreamsPerConn; max > 0 && pc.streams >= max {
+			continue
+		}
+		if best == nil || pc.streams < best.streams {
+			best = pc
+		}
+	}
+	return best
+}
+
+func (p *connPool) useLocked(pc *poolConn) {
+	pc.streams++
+	pc.lastUsed = time.Now()
+	if pc.idle != nil {
+		pc.idle.Stop()
+		pc.idle = nil
+	}
+}
+
+func (p *connPool) release(pc *poolConn) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	pc.streams--
+	pc.lastUsed = time.Now()
+	if pc.dropped {
+		if pc.streams == 0 {
+			pc.cc.Close()
+		}
+		return
+	}
+	if pc.streams == 0 && !p.closed {
+		if d := p.opts.idleConnTimeout(); d > 0 {
+			pc.idle = time.AfterFunc(d, func() { p.closeIdle(pc) })
+		}
+	}
+	p.notifyLocked()
+}
+
+func (p *connPool) closeIdle(pc *poolConn) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if pc.streams > 0 || time.Since(pc.lastUsed) < p.opts.idleConnTimeout() {
+		return
+	}
+	p.removeLocked(pc)
+	pc.cc.Close()
+}
+
+// dropDeadLocked removes connections that were closed, failed a health check
+// or received GOAWAY, and returns how many were dropped. With
+// StrictMaxConcurrentStreams a busy connection still takes new requests, so
+// only those are reported as unusable. Streams in flight on a dropped
+// connection are left to finish; it is closed after the last one.
+func (p *connPool) dropDeadLocked() (n int) {
+	for i := 0; i < len(p.conns); i++ {
+		pc := p.conns[i]
+		if !pc.cc.CanTakeNewRequest() {
+			p.removeLocked(pc)
+			pc.dropped = true
+			if pc.streams == 0 {
+				pc.cc.Close()
+			}
+			i--
+			n++
+		}
+	}
+	return
+}
+
+func (p *connPool) ping(ctx context.Context, pc *poolConn) error {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.pingTimeout())
+	defer cancel()
+	return pc.cc.Ping(ctx)
+}
+
+func (p *connPool) reportDead(n int, cause error) {
+	if p.opts.OnReconnect == nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		p.opts.OnReconnect(p.addr, cause)
+	}
+}
+
+func (p *connPool) removeLocked(pc *poolConn) {
+	for i, v := range p.conns {
+		if v == pc {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			break
+		}
+	}
+	if pc.idle != nil {
+		pc.idle.Stop()
+		pc.idle = nil
+	}
+	p.notifyLocked()
+}
+
+func (p *connPool) notifyLocked() {
+	close(p.wait)
+	p.wait = make(chan struct{})
+}
+
+func (p *connPool) dial(ctx context.Context) (*poolConn, error) {
+	dialer := &net.Dialer{Timeout: p.opts.dialTimeout(), KeepAlive: 30 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "dial fail")
+	}
+
+	cfg := p.tlsConfig.Clone()
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(p.addr)
+		if err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, "bad address")
+		}
+		cfg.ServerName = host
+	}
+	cfg.NextProtos = []string{http2.NextProtoTLS}
+
+	tlsConn := tls.Client(conn, cfg)
+	deadline := time.Now().Add(p.opts.tlsHandshakeTimeout())
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := tlsConn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "set deadline fail")
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "tls handshake fail")
+	}
+	if proto := tlsConn.ConnectionState().NegotiatedProtocol; proto != http2.NextProtoTLS {
+		conn.Close()
+		return nil, errors.Errorf("unexpected protocol: %q", proto)
+	}
+	if err := tlsConn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "set deadline fail")
+	}
+
+	cc, err := p.transport.NewClientConn(tlsConn)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "http2 handshake fail")
+	}
+
+	return &poolConn{cc: cc, lastUsed: time.Now()}, nil
+}
+
+// CloseIdleConnections closes every connection that has no streams in flight.
+func (p *connPool) CloseIdleConnections() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	for i := 0; i < len(p.conns); i++ {
+		pc := p.conns[i]
+		if pc.streams == 0 {
+			p.removeLocked(pc)
+			pc.cc.Close()
+			i--
+		}
+	}
+}
+
+func (p *connPool) Close() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.closed = true
+	for _, pc := range p.conns {
+		if pc.idle != nil {
+			pc.idle.Stop()
+		}
+		pc.cc.Close()
+	}
+	p.conns = nil
+	p.notifyLocked()
+	return nil
+}
+
+type poolBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *poolBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
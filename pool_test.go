@@ -0,0 +1,161 @@
+package apns_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tada-team/apns"
+	"github.com/tada-team/apns/apnstest"
+)
+
+func TestPoolSaturatedConnection(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		connections int
+		idleTimeout time.Duration
+		sends       int
+	}{
+		{name: "one connection", connections: 1, sends: 600},
+		{name: "two connections", connections: 2, sends: 600},
+		{name: "idle connections kept", connections: 1, idleTimeout: -1, sends: 600},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := newTestConfig(t)
+			var mux sync.Mutex
+			reconnects := 0
+			c.Transport = apns.TransportOpts{
+				Connections:     tt.connections,
+				IdleConnTimeout: tt.idleTimeout,
+				RootCAs:         c.Transport.RootCAs,
+				OnReconnect: func(addr string, cause error) {
+					mux.Lock()
+					reconnects++
+					mux.Unlock()
+				},
+			}
+			srv.Respond(func(*apnstest.Request) apnstest.Response {
+				return apnstest.Response{Delay: 20 * time.Millisecond}
+			})
+
+			var wg sync.WaitGroup
+			for i := 0; i < tt.sends; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					r := c.SendPayload(context.Background(), testToken, apns.NewPayload().AlertBody("hi"), apns.Headers{})
+					if r.Code != apns.Ok {
+						t.Errorf("code %d: %v", r.Code, r.Error)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if n := srv.Connections(); n > tt.connections {
+				t.Errorf("connections: got %d, want at most %d", n, tt.connections)
+			}
+			if reconnects != 0 {
+				t.Errorf("reconnects: got %d, want 0", reconnects)
+			}
+		})
+	}
+}
+
+func TestPoolReconnect(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		close bool
+		want  int
+	}{
+		{name: "healthy", want: 0},
+		{name: "closed by server", close: true, want: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := newTestConfig(t)
+			// a push racing the close may hit the closed connection before the pool notices
+			c.Retry = &apns.RetryPolicy{MaxAttempts: 10, MinBackoff: 10 * time.Millisecond, Jitter: -1}
+			reconnects := make(chan error, 10)
+			c.Transport.OnReconnect = func(addr string, cause error) {
+				reconnects <- cause
+			}
+
+			send := func() {
+				r := c.SendPayload(context.Background(), testToken, apns.NewPayload().AlertBody("hi"), apns.Headers{})
+				if r.Code != apns.Ok {
+					t.Fatalf("code %d after %d attempts: %v", r.Code, r.Attempts, r.Error)
+				}
+			}
+			send()
+			if tt.close {
+				srv.CloseConnections()
+			}
+			send()
+
+			for i := 0; i < tt.want; i++ {
+				select {
+				case <-reconnects:
+				case <-time.After(5 * time.Second):
+					t.Fatalf("reconnects: got %d, want %d", i, tt.want)
+				}
+			}
+			select {
+			case cause := <-reconnects:
+				t.Errorf("unexpected reconnect: %v", cause)
+			default:
+			}
+			if n := srv.Connections(); n != 1+tt.want {
+				t.Errorf("connections: got %d, want %d", n, 1+tt.want)
+			}
+		})
+	}
+}
+
+// A connection idle for longer than PingInterval is pinged, by the HTTP/2 health check or before it is
+// used again; one the server stopped answering is replaced before a push is lost on it.
+func TestPoolPing(t *testing.T) {
+	const pingInterval = 50 * time.Millisecond
+
+	for _, tt := range []struct {
+		name  string
+		stall bool
+		want  int
+	}{
+		{name: "answered", want: 0},
+		{name: "stalled", stall: true, want: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := newTestConfig(t)
+			c.Transport.PingInterval = pingInterval
+			c.Transport.PingTimeout = 2 * pingInterval
+			reconnects := make(chan error, 10)
+			c.Transport.OnReconnect = func(addr string, cause error) {
+				reconnects <- cause
+			}
+
+			send := func() apns.Result {
+				return c.SendPayload(context.Background(), testToken, apns.NewPayload().AlertBody("hi"), apns.Headers{})
+			}
+			if r := send(); r.Code != apns.Ok {
+				t.Fatalf("code %d after %d attempts: %v", r.Code, r.Attempts, r.Error)
+			}
+			if tt.stall {
+				srv.StallConnections()
+			}
+
+			// let the connection go idle for longer than the ping interval
+			time.Sleep(3 * pingInterval)
+
+			r := send()
+			if r.Code != apns.Ok || r.Attempts != 1 {
+				t.Fatalf("code %d after %d attempts: %v", r.Code, r.Attempts, r.Error)
+			}
+			if len(reconnects) != tt.want {
+				t.Errorf("reconnects: got %d, want %d", len(reconnects), tt.want)
+			}
+			if n := srv.Connections(); n != 1+tt.want {
+				t.Errorf("connections: got %d, want %d", n, 1+tt.want)
+			}
+		})
+	}
+}
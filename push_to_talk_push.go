@@ -0,0 +1,31 @@
+package apns
+
+import (
+	"context"
+	"fmt"
+)
+
+// PushToTalkPush tells a Push to Talk app about an incoming audio transmission. The system wakes the app,
+// which reads Data and reports the active participant; no alert is shown.
+type PushToTalkPush struct {
+	Data  map[string]interface{}
+	Token string
+}
+
+// Payload builds the notification payload.
+func (p PushToTalkPush) Payload() *Payload {
+	return NewPayload().CustomData(p.Data)
+}
+
+func (p PushToTalkPush) Send(c *Config, h *Headers) (r Result) {
+	return p.SendContext(context.Background(), c, h)
+}
+
+func (p PushToTalkPush) SendContext(ctx context.Context, c *Config, h *Headers) (r Result) {
+	url := fmt.Sprintf(urlMask, c.Host, p.Token)
+	hh := pushHeaders(h, PushTypePushToTalk)
+	if hh.Priority == 0 {
+		hh.Priority = 10
+	}
+	return c.SendContext(ctx, url, p.Payload(), hh, nil)
+}
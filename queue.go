@@ -0,0 +1,209 @@
+package apns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// QueuedPush is a push kept in a QueueStorage until it is delivered or expires.
+type QueuedPush struct {
+	// The apns-id of the push, also the key in the storage.
+	Id string `json:"id"`
+
+	Token    string          `json:"token"`
+	Payload  json.RawMessage `json:"payload"`
+	Headers  Headers         `json:"headers"`
+	Enqueued time.Time       `json:"enqueued"`
+	Attempts int             `json:"attempts"`
+
+	// The push is not sent again before this time.
+	NotBefore time.Time `json:"notBefore"`
+}
+
+// QueueStorage keeps pending pushes of a Queue.
+type QueueStorage interface {
+	// Put adds the push, or replaces the one with the same Id.
+	Put(p QueuedPush) error
+
+	// Remove deletes the push with id. Removing an unknown id is not an error.
+	Remove(id string) error
+
+	// List returns every pending push, oldest first.
+	List() ([]QueuedPush, error)
+
+	Close() error
+}
+
+// Queue sends pushes through Config and keeps the ones that failed with RetryNow or RetryLater
+// in Storage, so they survive a restart and are sent again by Replay or Run.
+type Queue struct {
+	Config  *Config
+	Storage QueueStorage
+
+	// Waits between attempts of a queued push and the maximum number of attempts, the first send
+	// included. Deadline is not used. Config.Retry, if set, still applies inside every attempt, so one
+	// attempt may make up to Config.Retry.MaxAttempts requests; leave it nil to let the Queue retry alone.
+	Retry RetryPolicy
+
+	// Pushes with a zero Headers.Expiration are dropped after this long in the queue. Defaults to 24 hours.
+	MaxAge time.Duration
+
+	// Optional. Called with the final result of every queued push: delivered, rejected, expired or
+	// out of attempts.
+	OnResult func(p QueuedPush, r Result)
+
+	mux sync.Mutex
+}
+
+func NewQueue(c *Config, s QueueStorage) *Queue {
+	return &Queue{Config: c, Storage: s}
+}
+
+// Send sends a push and queues it if it failed with RetryNow or RetryLater, or was canceled by
+// Config.Retry.Deadline. The returned Result is the one of this first attempt.
+func (q *Queue) Send(ctx context.Context, token string, payload interface{}, h Headers) Result {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Result{Code: FailNow, Error: errors.Wrap(err, "json fail")}
+	}
+	if p, ok := payload.(*Payload); ok && h.PushType == "" {
+		h.PushType = p.pushType()
+	}
+	if h.Id == "" {
+		h.Id = newUUID()
+	}
+
+	r := q.send(ctx, token, body, h)
+	if retryable(ctx, r) {
+		now := time.Now()
+		p := QueuedPush{
+			Id:        h.Id,
+			Token:     token,
+			Payload:   body,
+			Headers:   h,
+			Enqueued:  now,
+			Attempts:  1,
+			NotBefore: now.Add(q.Retry.backoff(1)),
+		}
+		if q.expired(p, now) {
+			return r
+		}
+		if err := q.Storage.Put(p); err != nil {
+			r.Error = errors.Wrapf(r.Error, "queue put fail: %v", err)
+		}
+	}
+	return r
+}
+
+func (q *Queue) send(ctx context.Context, token string, body json.RawMessage, h Headers) Result {
+	return q.Config.SendContext(ctx, fmt.Sprintf(urlMask, q.Config.Host, token), body, h, nil)
+}
+
+// retryable reports whether a push with result r is kept for a later attempt. A push canceled while ctx
+// is still live ran out of Config.Retry.Deadline and is retried like RetryLater.
+func retryable(ctx context.Context, r Result) bool {
+	switch r.Code {
+	case RetryNow, RetryLater:
+		return true
+	case Canceled:
+		return ctx.Err() == nil
+	}
+	return false
+}
+
+func (q *Queue) expired(p QueuedPush, now time.Time) bool {
+	if !p.Headers.Expiration.IsZero() {
+		return !now.Before(p.Headers.Expiration)
+	}
+	maxAge := q.MaxAge
+	if maxAge <= 0 {
+		maxAge = 24 * time.Hour
+	}
+	return now.Sub(p.Enqueued) >= maxAge
+}
+
+// Replay sends every queued push that is due, drops the expired ones, and keeps the ones failing
+// again for a later attempt. It stops early if ctx is done.
+func (q *Queue) Replay(ctx context.Context) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	pushes, err := q.Storage.List()
+	if err != nil {
+		return errors.Wrap(err, "queue list fail")
+	}
+
+	for _, p := range pushes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if q.expired(p, now) {
+			if err := q.Storage.Remove(p.Id); err != nil {
+				return errors.Wrap(err, "queue remove fail")
+			}
+			q.report(p, Result{Code: FailNow, Error: errors.New("expired"), ApnsId: p.Id, Attempts: p.Attempts})
+			continue
+		}
+		if now.Before(p.NotBefore) {
+			continue
+		}
+
+		r := q.send(ctx, p.Token, p.Payload, p.Headers)
+		if r.Code == Canceled && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		p.Attempts++
+		r.Attempts = p.Attempts
+
+		if retryable(ctx, r) && p.Attempts < q.Retry.maxAttempts() {
+			p.NotBefore = time.Now().Add(q.Retry.backoff(p.Attempts))
+			if err := q.Storage.Put(p); err != nil {
+				return errors.Wrap(err, "queue put fail")
+			}
+			continue
+		}
+
+		if err := q.Storage.Remove(p.Id); err != nil {
+			return errors.Wrap(err, "queue remove fail")
+		}
+		q.report(p, r)
+	}
+	return nil
+}
+
+func (q *Queue) report(p QueuedPush, r Result) {
+	if q.OnResult != nil {
+		q.OnResult(p, r)
+	}
+}
+
+// Run calls Replay every interval until ctx is done.
+func (q *Queue) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := q.Replay(ctx); err != nil && ctx.Err() == nil {
+			log.Println("apns: queue replay fail:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Len returns the number of queued pushes.
+func (q *Queue) Len() (int, error) {
+	pushes, err := q.Storage.List()
+	return len(pushes), err
+}
@@ -0,0 +1,233 @@
+package apns
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// MemoryQueueStorage is a QueueStorage that does not survive a restart, for tests and for Queues
+// used only to retry pushes later.
+type MemoryQueueStorage struct {
+	mux    sync.Mutex
+	pushes map[string]QueuedPush
+}
+
+func NewMemoryQueueStorage() *MemoryQueueStorage {
+	return &MemoryQueueStorage{pushes: make(map[string]QueuedPush)}
+}
+
+func (s *MemoryQueueStorage) Put(p QueuedPush) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.pushes[p.Id] = p
+	return nil
+}
+
+func (s *MemoryQueueStorage) Remove(id string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.pushes, id)
+	return nil
+}
+
+func (s *MemoryQueueStorage) List() ([]QueuedPush, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return sortedPushes(s.pushes), nil
+}
+
+func (s *MemoryQueueStorage) Close() error {
+	return nil
+}
+
+func sortedPushes(m map[string]QueuedPush) []QueuedPush {
+	res := make([]QueuedPush, 0, len(m))
+	for _, p := range m {
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Enqueued.Equal(res[j].Enqueued) {
+			return res[i].Id < res[j].Id
+		}
+		return res[i].Enqueued.Before(res[j].Enqueued)
+	})
+	return res
+}
+
+// FileQueueStorage is a QueueStorage kept in an append-only log file: every Put and Remove appends
+// one JSON line, synced to disk before returning. The log is compacted when it is opened and when
+// it holds many more records than pending pushes.
+type FileQueueStorage struct {
+	path    string
+	mux     sync.Mutex
+	file    *os.File
+	pushes  map[string]QueuedPush
+	records int
+}
+
+type queueRecord struct {
+	Put    *QueuedPush `json:"put,omitempty"`
+	Remove string      `json:"remove,omitempty"`
+}
+
+// OpenFileQueueStorage opens the log at path, creating it if needed, and loads the pending pushes.
+func OpenFileQueueStorage(path string) (*FileQueueStorage, error) {
+	s := &FileQueueStorage{
+		path:   path,
+		pushes: make(map[string]QueuedPush),
+	}
+
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "open queue fail")
+	}
+	if err == nil {
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 64<<10), 1<<20)
+		for sc.Scan() {
+			rec := new(queueRecord)
+			if err := json.Unmarshal(sc.Bytes(), rec); err != nil {
+				// a torn last line after a crash
+				continue
+			}
+			s.apply(rec)
+		}
+		err := sc.Err()
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "read queue fail")
+		}
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileQueueStorage) apply(rec *queueRecord) {
+	if rec.Put != nil {
+		s.pushes[rec.Put.Id] = *rec.Put
+	} else if rec.Remove != "" {
+		delete(s.pushes, rec.Remove)
+	}
+}
+
+// compact rewrites the log with one record per pending push and reopens it for appending.
+func (s *FileQueueStorage) compact() error {
+	f, err := ioutil.TempFile(filepath.Dir(s.path), ".queue-")
+	if err != nil {
+		return errors.Wrap(err, "create temp file fail")
+	}
+
+	w := bufio.NewWriter(f)
+	for _, p := range sortedPushes(s.pushes) {
+		p := p
+		b, err := json.Marshal(queueRecord{Put: &p})
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return errors.Wrap(err, "json fail")
+		}
+		w.Write(b)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return errors.Wrap(err, "write queue fail")
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return errors.Wrap(err, "sync queue fail")
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "write queue fail")
+	}
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "rename queue fail")
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "open queue fail")
+	}
+	s.records = len(s.pushes)
+	return nil
+}
+
+func (s *FileQueueStorage) append(rec *queueRecord) error {
+	if s.file == nil {
+		return errors.New("queue closed")
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "json fail")
+	}
+	if _, err := s.file.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err, "write queue fail")
+	}
+	if err := s.file.Sync(); err != nil {
+		return errors.Wrap(err, "sync queue fail")
+	}
+
+	s.apply(rec)
+	s.records++
+	if s.records > 1000 && s.records > 4*len(s.pushes) {
+		return s.compact()
+	}
+	return nil
+}
+
+func (s *FileQueueStorage) Put(p QueuedPush) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.append(&queueRecord{Put: &p})
+}
+
+func (s *FileQueueStorage) Remove(id string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, ok := s.pushes[id]; !ok {
+		return nil
+	}
+	return s.append(&queueRecord{Remove: id})
+}
+
+func (s *FileQueueStorage) List() ([]QueuedPush, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return sortedPushes(s.pushes), nil
+}
+
+func (s *FileQueueStorage) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,214 @@
+package apns
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueueStorage(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		open func(t *testing.T) QueueStorage
+	}{
+		{name: "memory", open: func(t *testing.T) QueueStorage { return NewMemoryQueueStorage() }},
+		{name: "file", open: func(t *testing.T) QueueStorage {
+			s, err := OpenFileQueueStorage(filepath.Join(t.TempDir(), "queue"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.open(t)
+			defer s.Close()
+
+			now := time.Now()
+			for i, id := range []string{"c", "a", "b"} {
+				if err := s.Put(QueuedPush{Id: id, Enqueued: now.Add(time.Duration(i) * time.Second)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Put(QueuedPush{Id: "a", Enqueued: now.Add(time.Second), Attempts: 2}); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range []string{"b", "unknown"} {
+				if err := s.Remove(id); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			pushes, err := s.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := queuedIds(pushes); got != "c a" {
+				t.Fatalf("pushes: got %s, want c a", got)
+			}
+			if pushes[1].Attempts != 2 {
+				t.Errorf("attempts: got %d, want 2", pushes[1].Attempts)
+			}
+		})
+	}
+}
+
+func TestFileQueueStorageOpen(t *testing.T) {
+	now := time.Now().Round(0)
+	for _, tt := range []struct {
+		name  string
+		write func(s *FileQueueStorage) error
+		tail  string // appended to the log after Close, as by a crash
+		want  string
+	}{
+		{
+			name: "replay",
+			write: func(s *FileQueueStorage) error {
+				for i := 0; i < 3; i++ {
+					if err := s.Put(QueuedPush{Id: fmt.Sprint(i), Enqueued: now.Add(time.Duration(i))}); err != nil {
+						return err
+					}
+				}
+				return s.Remove("1")
+			},
+			want: "0 2",
+		},
+		{
+			name: "torn trailing line",
+			write: func(s *FileQueueStorage) error {
+				return s.Put(QueuedPush{Id: "0", Enqueued: now})
+			},
+			tail: `{"put":{"id":"1","tok`,
+			want: "0",
+		},
+		{
+			name: "torn remove",
+			write: func(s *FileQueueStorage) error {
+				return s.Put(QueuedPush{Id: "0", Enqueued: now})
+			},
+			tail: `{"remove":"0`,
+			want: "0",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "queue")
+			s, err := OpenFileQueueStorage(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.write(s); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.tail != "" {
+				f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.WriteString(tt.tail)
+				f.Close()
+			}
+
+			s, err = OpenFileQueueStorage(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			pushes, err := s.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := queuedIds(pushes); got != tt.want {
+				t.Fatalf("pushes: got %s, want %s", got, tt.want)
+			}
+			if !pushes[0].Enqueued.Equal(now) {
+				t.Errorf("enqueued: got %v, want %v", pushes[0].Enqueued, now)
+			}
+
+			// the log is compacted on open: one record per pending push, the torn line gone
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := bytes.Count(b, []byte("\n")); n != len(pushes) || !bytes.HasSuffix(b, []byte("\n")) {
+				t.Errorf("log after open: %d records, want %d: %s", n, len(pushes), b)
+			}
+
+			// appending after a torn line must not glue the record to it
+			if err := s.Put(QueuedPush{Id: "new", Enqueued: now.Add(time.Hour)}); err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+			s, err = OpenFileQueueStorage(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pushes, _ = s.List()
+			if got := queuedIds(pushes); got != tt.want+" new" {
+				t.Errorf("pushes after reopen: got %s, want %s new", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileQueueStorageCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+	s, err := OpenFileQueueStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	if err := s.Put(QueuedPush{Id: "kept", Enqueued: now}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprint(i)
+		if err := s.Put(QueuedPush{Id: id, Enqueued: now.Add(time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Remove(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if s.records > 1000 {
+		t.Errorf("records: got %d, want compacted", s.records)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(b, []byte("\n")); n != s.records {
+		t.Errorf("log lines: got %d, want %d", n, s.records)
+	}
+
+	s.Close()
+	s, err = OpenFileQueueStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushes, _ := s.List()
+	if got := queuedIds(pushes); got != "kept" {
+		t.Errorf("pushes after compaction: got %s, want kept", got)
+	}
+}
+
+func queuedIds(pushes []QueuedPush) string {
+	var b bytes.Buffer
+	for i, p := range pushes {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(p.Id)
+	}
+	return b.String()
+}
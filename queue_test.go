@@ -0,0 +1,177 @@
+package apns_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tada-team/apns"
+	"github.com/tada-team/apns/apnstest"
+)
+
+func TestQueueReplay(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		expiration time.Duration // from the first send, zero for none
+		configure  func(c *apns.Config)
+		maxAge     time.Duration
+		responses  []apnstest.Response
+		replays    int
+		wantQueued bool
+		wantCode   apns.ResultCode
+		wantReport string // reported error, empty for none
+		requests   int
+	}{
+		{
+			name:     "delivered",
+			wantCode: apns.Ok,
+			requests: 1,
+		},
+		{
+			name:       "retried on replay",
+			responses:  []apnstest.Response{apnstest.Reject(apns.TooManyRequests)},
+			replays:    1,
+			wantQueued: true,
+			wantCode:   apns.RetryLater,
+			wantReport: "<nil>",
+			requests:   2,
+		},
+		{
+			name:       "out of attempts",
+			responses:  []apnstest.Response{apnstest.Reject(apns.TooManyRequests), apnstest.Reject(apns.TooManyRequests), apnstest.Reject(apns.TooManyRequests)},
+			replays:    3,
+			wantQueued: true,
+			wantCode:   apns.RetryLater,
+			wantReport: apns.TooManyRequests.Error(),
+			requests:   3,
+		},
+		{
+			name:       "rejected on replay",
+			responses:  []apnstest.Response{apnstest.Reject(apns.ServiceUnavailable), apnstest.Reject(apns.BadDeviceToken)},
+			replays:    1,
+			wantQueued: true,
+			wantCode:   apns.RetryLater,
+			wantReport: apns.BadDeviceToken.Error(),
+			requests:   2,
+		},
+		{
+			name:       "past expiration",
+			expiration: 50 * time.Millisecond,
+			responses:  []apnstest.Response{apnstest.Reject(apns.TooManyRequests)},
+			replays:    1,
+			wantQueued: true,
+			wantCode:   apns.RetryLater,
+			wantReport: "expired",
+			requests:   1,
+		},
+		{
+			name:       "past max age",
+			maxAge:     50 * time.Millisecond,
+			responses:  []apnstest.Response{apnstest.Reject(apns.TooManyRequests)},
+			replays:    1,
+			wantQueued: true,
+			wantCode:   apns.RetryLater,
+			wantReport: "expired",
+			requests:   1,
+		},
+		{
+			name: "retry deadline",
+			configure: func(c *apns.Config) {
+				c.Retry = &apns.RetryPolicy{Deadline: 20 * time.Millisecond}
+			},
+			responses:  []apnstest.Response{{Delay: time.Second}, {Delay: time.Second}},
+			replays:    1,
+			wantQueued: true,
+			wantCode:   apns.Canceled,
+			wantReport: "",
+			requests:   2,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := newTestConfig(t)
+			if tt.configure != nil {
+				tt.configure(c)
+			}
+			srv.Enqueue(tt.responses...)
+
+			q := apns.NewQueue(c, apns.NewMemoryQueueStorage())
+			q.Retry = apns.RetryPolicy{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Jitter: -1}
+			q.MaxAge = tt.maxAge
+
+			var reports []apns.Result
+			q.OnResult = func(p apns.QueuedPush, r apns.Result) {
+				reports = append(reports, r)
+			}
+
+			var h apns.Headers
+			if tt.expiration > 0 {
+				h.Expiration = time.Now().Add(tt.expiration)
+			}
+			ctx := context.Background()
+			r := q.Send(ctx, testToken, apns.NewPayload().AlertBody("Hi"), h)
+			if r.Code != tt.wantCode {
+				t.Fatalf("code: got %v, want %v (%v)", r.Code, tt.wantCode, r.Error)
+			}
+			if n, _ := q.Len(); n != 1 && tt.wantQueued || n != 0 && !tt.wantQueued {
+				t.Fatalf("queued: got %d, want %v", n, tt.wantQueued)
+			}
+
+			for i := 0; i < tt.replays; i++ {
+				time.Sleep(60 * time.Millisecond)
+				if err := q.Replay(ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			n, err := q.Len()
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.wantReport == "" && tt.wantQueued:
+				if n != 1 || len(reports) != 0 {
+					t.Errorf("got %d queued and reports %v, want still queued", n, reports)
+				}
+			case tt.wantReport != "":
+				if n != 0 || len(reports) != 1 {
+					t.Fatalf("got %d queued and reports %v, want one report", n, reports)
+				}
+				if got := errString(reports[0].Error); got != tt.wantReport {
+					t.Errorf("report: got %s, want %s", got, tt.wantReport)
+				}
+			}
+			if reqs := srv.Requests(); len(reqs) != tt.requests {
+				t.Errorf("requests: got %d, want %d", len(reqs), tt.requests)
+			}
+		})
+	}
+}
+
+// Replay must return the error of a done ctx and keep the pushes it did not send.
+func TestQueueReplayCanceled(t *testing.T) {
+	c, srv := newTestConfig(t)
+	srv.Enqueue(apnstest.Reject(apns.TooManyRequests), apnstest.Reject(apns.TooManyRequests))
+
+	q := apns.NewQueue(c, apns.NewMemoryQueueStorage())
+	q.Retry = apns.RetryPolicy{MinBackoff: time.Millisecond, Jitter: -1}
+	for i := 0; i < 2; i++ {
+		q.Send(context.Background(), testToken, apns.NewPayload().AlertBody("Hi"), apns.Headers{})
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := q.Replay(ctx); err != context.Canceled {
+		t.Fatalf("err: got %v, want %v", err, context.Canceled)
+	}
+	if n, _ := q.Len(); n != 2 {
+		t.Errorf("queued: got %d, want 2", n)
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return "<nil>"
+	}
+	return err.Error()
+}
@@ -0,0 +1,265 @@
+package apns
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RateMode is what a RateLimiter does with a push over the limit.
+type RateMode int
+
+const (
+	// The push waits until it is within the limit, or until its context is done.
+	RateWait RateMode = iota
+
+	// The push is not sent and fails with RetryLater and ErrRateLimited.
+	RateDrop
+
+	// Like RateWait, but a waiting push with a CollapseId is replaced by a newer push to the same device
+	// token with the same CollapseId. The replaced push fails with FailNow and ErrCollapsed, the newer one
+	// takes its place in the wait. Pushes without a CollapseId wait.
+	RateCollapse
+)
+
+var (
+	ErrRateLimited = errors.New("rate limited")
+	ErrCollapsed   = errors.New("collapsed")
+)
+
+// RateLimit is a token bucket: Rate pushes per second on average, Burst pushes at once. A zero Rate
+// means no limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (v RateLimit) burst() float64 {
+	if v.Burst < 1 {
+		return 1
+	}
+	return float64(v.Burst)
+}
+
+// RateLimiter limits pushes per device token and per topic before they are sent, so APNs does not
+// answer TooManyRequests. It is safe to change the limits while pushes are being sent.
+type RateLimiter struct {
+	mux      sync.Mutex
+	perToken RateLimit
+	perTopic RateLimit
+	mode     RateMode
+	tokens   map[string]*bucket
+	topics   map[string]*bucket
+	pending  map[string]*pendingPush
+	swept    time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// pendingPush is a push waiting for its reservation in the token and topic buckets.
+type pendingPush struct {
+	key      string // token and CollapseId, empty if the push cannot be collapsed
+	token    string
+	topic    string
+	at       time.Time
+	replaced chan struct{}
+}
+
+func NewRateLimiter(perToken, perTopic RateLimit, mode RateMode) *RateLimiter {
+	return &RateLimiter{
+		perToken: perToken,
+		perTopic: perTopic,
+		mode:     mode,
+		tokens:   make(map[string]*bucket),
+		topics:   make(map[string]*bucket),
+		pending:  make(map[string]*pendingPush),
+	}
+}
+
+// SetTokenLimit changes the limit per device token.
+func (l *RateLimiter) SetTokenLimit(v RateLimit) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.perToken = v
+}
+
+// SetTopicLimit changes the limit per topic.
+func (l *RateLimiter) SetTopicLimit(v RateLimit) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.perTopic = v
+}
+
+func (l *RateLimiter) SetMode(v RateMode) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.mode = v
+}
+
+func (l *RateLimiter) Limits() (perToken, perTopic RateLimit, mode RateMode) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.perToken, l.perTopic, l.mode
+}
+
+// wait blocks until a push may be sent. If it may not, it returns false and the Result of the push.
+func (l *RateLimiter) wait(ctx context.Context, token, topic, collapseId string) (Result, bool) {
+	l.mux.Lock()
+	pp, r, ok := l.reserveLocked(token, topic, collapseId, time.Now())
+	l.mux.Unlock()
+
+	if pp == nil {
+		return r, ok
+	}
+	return l.await(ctx, pp)
+}
+
+// reserveLocked takes the place of a push in the buckets, or of the waiting push it collapses. It
+// returns nil if the push is sent or dropped at once.
+func (l *RateLimiter) reserveLocked(token, topic, collapseId string, now time.Time) (*pendingPush, Result, bool) {
+	if l.tokens == nil {
+		l.tokens = make(map[string]*bucket)
+		l.topics = make(map[string]*bucket)
+		l.pending = make(map[string]*pendingPush)
+	}
+	l.sweep(now)
+
+	var key string
+	if l.mode == RateCollapse && collapseId != "" {
+		key = token + "\n" + collapseId
+		if old, ok := l.pending[key]; ok {
+			// take the place of the older push, no new reservation
+			close(old.replaced)
+			pp := &pendingPush{key: key, token: token, topic: topic, at: old.at, replaced: make(chan struct{})}
+			l.pending[key] = pp
+			return pp, Result{}, false
+		}
+	}
+
+	tb := l.bucket(l.tokens, token, l.perToken, now)
+	pb := l.bucket(l.topics, topic, l.perTopic, now)
+
+	if l.mode == RateDrop && (tb != nil && tb.tokens < 1 || pb != nil && pb.tokens < 1) {
+		return nil, Result{Code: RetryLater, Error: ErrRateLimited}, false
+	}
+
+	var d time.Duration
+	if w := tb.take(l.perToken); w > d {
+		d = w
+	}
+	if w := pb.take(l.perTopic); w > d {
+		d = w
+	}
+	if d <= 0 {
+		return nil, Result{}, true
+	}
+
+	pp := &pendingPush{key: key, token: token, topic: topic, at: now.Add(d), replaced: make(chan struct{})}
+	if key != "" {
+		l.pending[key] = pp
+	}
+	return pp, Result{}, false
+}
+
+// await waits for the reservation of pp. The winner of a collapse is decided under the lock, so a push
+// replaced just as its wait ended is not sent next to the newer one.
+func (l *RateLimiter) await(ctx context.Context, pp *pendingPush) (Result, bool) {
+	timer := time.NewTimer(time.Until(pp.at))
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-timer.C:
+	case <-pp.replaced:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if pp.key != "" {
+		if l.pending[pp.key] != pp {
+			return Result{Code: FailNow, Error: ErrCollapsed}, false
+		}
+		delete(l.pending, pp.key)
+	}
+	if err != nil {
+		l.refund(pp)
+		return Result{Code: Canceled, Error: errors.Wrap(err, "rate limit wait fail")}, false
+	}
+	return Result{}, true
+}
+
+// refund gives back the reservation of a push that was not sent.
+func (l *RateLimiter) refund(pp *pendingPush) {
+	for _, s := range []struct {
+		b     *bucket
+		limit RateLimit
+	}{{l.tokens[pp.token], l.perToken}, {l.topics[pp.topic], l.perTopic}} {
+		if s.b == nil || s.limit.Rate <= 0 {
+			continue
+		}
+		s.b.tokens++
+		if burst := s.limit.burst(); s.b.tokens > burst {
+			s.b.tokens = burst
+		}
+	}
+}
+
+// bucket returns the refilled bucket of key, or nil if there is no limit.
+func (l *RateLimiter) bucket(m map[string]*bucket, key string, limit RateLimit, now time.Time) *bucket {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	burst := limit.burst()
+	b, ok := m[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		m[key] = b
+		return b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	return b
+}
+
+// take reserves one push and returns the wait until it is within the limit.
+func (b *bucket) take(limit RateLimit) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / limit.Rate * float64(time.Second))
+}
+
+// sweep drops full buckets once a minute, so the maps do not grow with every device token ever seen.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+
+	for _, s := range []struct {
+		m     map[string]*bucket
+		limit RateLimit
+	}{{l.tokens, l.perToken}, {l.topics, l.perTopic}} {
+		for k, b := range s.m {
+			if s.limit.Rate <= 0 || b.tokens+now.Sub(b.last).Seconds()*s.limit.Rate >= s.limit.burst() {
+				delete(s.m, k)
+			}
+		}
+	}
+}
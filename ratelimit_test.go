@@ -0,0 +1,170 @@
+package apns
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	const token, otherToken, topic = "token", "other", "com.example.app"
+	perSecond := RateLimit{Rate: 10, Burst: 1}
+
+	type push struct {
+		token      string
+		collapseId string
+		wantErr    error // nil if sent
+		wantWait   time.Duration
+	}
+	for _, tt := range []struct {
+		name     string
+		perToken RateLimit
+		perTopic RateLimit
+		mode     RateMode
+		pushes   []push // started 10ms apart
+	}{
+		{
+			name:   "no limit",
+			pushes: []push{{token: token}, {token: token}},
+		},
+		{
+			name:     "wait per token",
+			perToken: perSecond,
+			pushes:   []push{{token: token}, {token: token, wantWait: 100 * time.Millisecond}, {token: otherToken}},
+		},
+		{
+			name:     "wait per topic",
+			perTopic: perSecond,
+			pushes:   []push{{token: token}, {token: otherToken, wantWait: 100 * time.Millisecond}},
+		},
+		{
+			name:     "burst",
+			perToken: RateLimit{Rate: 10, Burst: 2},
+			pushes:   []push{{token: token}, {token: token}, {token: token, wantWait: 100 * time.Millisecond}},
+		},
+		{
+			name:     "drop",
+			perToken: perSecond,
+			mode:     RateDrop,
+			pushes:   []push{{token: token}, {token: token, wantErr: ErrRateLimited}, {token: otherToken}},
+		},
+		{
+			name:     "collapse",
+			perToken: perSecond,
+			mode:     RateCollapse,
+			pushes: []push{
+				{token: token},
+				{token: token, collapseId: "a", wantErr: ErrCollapsed},
+				{token: token, collapseId: "a", wantWait: 100 * time.Millisecond},
+				{token: token, collapseId: "b", wantWait: 200 * time.Millisecond},
+				{token: token, wantWait: 300 * time.Millisecond},
+			},
+		},
+		{
+			name:     "wait ignores collapse id",
+			perToken: perSecond,
+			pushes:   []push{{token: token}, {token: token, collapseId: "a", wantWait: 100 * time.Millisecond}, {token: token, collapseId: "a", wantWait: 200 * time.Millisecond}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(tt.perToken, tt.perTopic, tt.mode)
+			start := time.Now()
+
+			var wg sync.WaitGroup
+			for i, p := range tt.pushes {
+				time.Sleep(time.Until(start.Add(time.Duration(i) * 10 * time.Millisecond)))
+				wg.Add(1)
+				go func(p push) {
+					defer wg.Done()
+					r, ok := l.wait(context.Background(), p.token, topic, p.collapseId)
+					if ok != (p.wantErr == nil) || !errors.Is(r.Error, p.wantErr) {
+						t.Errorf("push %+v: got %v, %v", p, ok, r.Error)
+						return
+					}
+					if !ok {
+						return
+					}
+					if wait := time.Since(start); wait < p.wantWait || wait > p.wantWait+70*time.Millisecond {
+						t.Errorf("push %+v: sent after %v", p, wait)
+					}
+				}(p)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// A push canceled while it waits gives its reservation back.
+func TestRateLimiterCancel(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		mode       RateMode
+		collapseId string
+	}{
+		{name: "wait", mode: RateWait},
+		{name: "collapse", mode: RateCollapse, collapseId: "a"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(RateLimit{Rate: 1}, RateLimit{Rate: 1}, tt.mode)
+			if _, ok := l.wait(context.Background(), "token", "topic", ""); !ok {
+				t.Fatal("first push not sent")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			r, ok := l.wait(ctx, "token", "topic", tt.collapseId)
+			if ok || r.Code != Canceled {
+				t.Fatalf("got %v, %v (%v)", ok, r.Code, r.Error)
+			}
+
+			l.mux.Lock()
+			defer l.mux.Unlock()
+			for name, b := range map[string]*bucket{"token": l.tokens["token"], "topic": l.topics["topic"]} {
+				if b.tokens < -0.5 {
+					t.Errorf("%s bucket: %.2f tokens, want the canceled push refunded", name, b.tokens)
+				}
+			}
+			if len(l.pending) != 0 {
+				t.Errorf("pending: %d left", len(l.pending))
+			}
+		})
+	}
+}
+
+// A push replaced after its wait ended, but before it took the lock, is not sent next to the newer one.
+func TestRateLimiterCollapseRace(t *testing.T) {
+	l := NewRateLimiter(RateLimit{Rate: 100}, RateLimit{}, RateCollapse)
+	l.wait(context.Background(), "token", "topic", "")
+
+	older := make(chan Result, 1)
+	go func() {
+		r, _ := l.wait(context.Background(), "token", "topic", "a")
+		older <- r
+	}()
+	for {
+		l.mux.Lock()
+		if l.pending["token\na"] != nil {
+			break
+		}
+		l.mux.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	// the older push's timer fires while the newer one holds the lock
+	time.Sleep(30 * time.Millisecond)
+	pp, _, _ := l.reserveLocked("token", "topic", "a", time.Now())
+	l.mux.Unlock()
+	if pp == nil {
+		t.Fatal("newer push not waiting")
+	}
+
+	if r := <-older; !errors.Is(r.Error, ErrCollapsed) {
+		t.Errorf("older push: got %v, want %v", r.Error, ErrCollapsed)
+	}
+	if r, ok := l.await(context.Background(), pp); !ok {
+		t.Errorf("newer push: got %v", r.Error)
+	}
+}
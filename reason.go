@@ -0,0 +1,221 @@
+package apns
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Reason is the error string APNs returns in the reason field of a failed response. Reasons are errors,
+// so a Result error can be checked with errors.Is(r.Error, apns.Unregistered).
+type Reason string
+
+func (r Reason) Error() string {
+	return string(r)
+}
+
+const (
+	// 400. The collapse identifier exceeds the maximum allowed size.
+	BadCollapseId = Reason("BadCollapseId")
+
+	// 400. The specified device token is invalid. Verify that the request contains a valid token and that
+	// the token matches the environment.
+	BadDeviceToken = Reason("BadDeviceToken")
+
+	// 400. The apns-expiration value is invalid.
+	BadExpirationDate = Reason("BadExpirationDate")
+
+	// 400. The apns-id value is invalid.
+	BadMessageId = Reason("BadMessageId")
+
+	// 400. The apns-priority value is invalid.
+	BadPriority = Reason("BadPriority")
+
+	// 400. The apns-topic value is invalid.
+	BadTopic = Reason("BadTopic")
+
+	// 400. The device token doesn’t match the specified topic.
+	DeviceTokenNotForTopic = Reason("DeviceTokenNotForTopic")
+
+	// 400. One or more headers are repeated.
+	DuplicateHeaders = Reason("DuplicateHeaders")
+
+	// 400. Idle timeout.
+	IdleTimeout = Reason("IdleTimeout")
+
+	// 400. The apns-push-type value is invalid.
+	InvalidPushType = Reason("InvalidPushType")
+
+	// 400. The device token isn’t specified in the request :path.
+	MissingDeviceToken = Reason("MissingDeviceToken")
+
+	// 400. The apns-topic header of the request isn’t specified and is required. The apns-topic header
+	// is mandatory when the client is connected using a certificate that supports multiple topics.
+	MissingTopic = Reason("MissingTopic")
+
+	// 400. The message payload is empty.
+	PayloadEmpty = Reason("PayloadEmpty")
+
+	// 400. Pushing to this topic is not allowed.
+	TopicDisallowed = Reason("TopicDisallowed")
+
+	// 400. The apns-channel-id header of a broadcast or channel request isn’t specified.
+	MissingChannelId = Reason("MissingChannelId")
+
+	// 400. The apns-channel-id value is invalid.
+	BadChannelId = Reason("BadChannelId")
+
+	// 400. The channel can’t be created, for example because the app reached the maximum number of channels.
+	CannotCreateChannelConfig = Reason("CannotCreateChannelConfig")
+
+	// 400. The message-storage-policy value of a new channel is invalid.
+	BadMessageStoragePolicy = Reason("BadMessageStoragePolicy")
+
+	// 403. The certificate is invalid.
+	BadCertificate = Reason("BadCertificate")
+
+	// 403. The client certificate is for the wrong environment.
+	BadCertificateEnvironment = Reason("BadCertificateEnvironment")
+
+	// 403. The provider token is stale and a new token should be generated.
+	ExpiredProviderToken = Reason("ExpiredProviderToken")
+
+	// 403. The specified action is not allowed.
+	Forbidden = Reason("Forbidden")
+
+	// 403. The provider token is not valid, or the token signature can’t be verified.
+	InvalidProviderToken = Reason("InvalidProviderToken")
+
+	// 403. No provider certificate was used to connect to APNs, and the authorization header is missing
+	// or no provider token is specified.
+	MissingProviderToken = Reason("MissingProviderToken")
+
+	// 403. The key ID in the provider token isn’t related to the key ID of the token used in the first
+	// push of this connection.
+	UnrelatedKeyIdInToken = Reason("UnrelatedKeyIdInToken")
+
+	// 403. The key ID in the provider token doesn’t match the environment.
+	BadEnvironmentKeyInToken = Reason("BadEnvironmentKeyInToken")
+
+	// 404. The request contained an invalid :path value.
+	BadPath = Reason("BadPath")
+
+	// 404. The channel doesn’t exist, or was deleted.
+	ChannelNotRegistered = Reason("ChannelNotRegistered")
+
+	// 405. The specified :method value isn’t POST.
+	MethodNotAllowed = Reason("MethodNotAllowed")
+
+	// 410. The device token has expired.
+	ExpiredToken = Reason("ExpiredToken")
+
+	// 410. The device token is inactive for the specified topic.
+	Unregistered = Reason("Unregistered")
+
+	// 413. The message payload is too large.
+	PayloadTooLarge = Reason("PayloadTooLarge")
+
+	// 429. The provider’s authentication token is being updated too often.
+	TooManyProviderTokenUpdates = Reason("TooManyProviderTokenUpdates")
+
+	// 429. Too many requests were made consecutively to the same device token.
+	TooManyRequests = Reason("TooManyRequests")
+
+	// 500. An internal server error occurred.
+	InternalServerError = Reason("InternalServerError")
+
+	// 503. The service is unavailable.
+	ServiceUnavailable = Reason("ServiceUnavailable")
+
+	// 503. The APNs server is shutting down.
+	Shutdown = Reason("Shutdown")
+)
+
+// Code returns how a push failing for this reason should be handled.
+func (r Reason) Code() ResultCode {
+	switch r {
+	case Unregistered, ExpiredToken:
+		return InvalidToken
+	case BadDeviceToken, TopicDisallowed, DeviceTokenNotForTopic, BadTopic,
+		InvalidProviderToken, BadCertificate, BadCertificateEnvironment, Forbidden,
+		UnrelatedKeyIdInToken, BadEnvironmentKeyInToken:
+		return InvalidConfig
+	case ExpiredProviderToken, IdleTimeout:
+		return RetryNow
+	case TooManyRequests, TooManyProviderTokenUpdates, InternalServerError, ServiceUnavailable, Shutdown:
+		return RetryLater
+	default:
+		return FailNow
+	}
+}
+
+// Error is a push rejected by APNs.
+type Error struct {
+	Reason Reason
+
+	// The HTTP status of the response.
+	StatusCode int
+
+	// The apns-id of the rejected notification, or the apns-request-id of a rejected channel request.
+	ApnsId string
+
+	// For 410 responses, the time at which APNs confirmed the token was no longer valid for the topic.
+	Timestamp time.Time
+
+	// How the push should be handled: FailNow, RetryNow, RetryLater, InvalidConfig or InvalidToken.
+	Code ResultCode
+}
+
+func (e *Error) Error() string {
+	return string(e.Reason)
+}
+
+// Is reports whether target is the Reason of e, or an *Error with the same Reason.
+func (e *Error) Is(target error) bool {
+	switch t := target.(type) {
+	case Reason:
+		return e.Reason == t
+	case *Error:
+		return e.Reason == t.Reason
+	}
+	return false
+}
+
+func (e *Error) Unwrap() error {
+	return e.Reason
+}
+
+// Temporary reports whether the push may succeed if sent again.
+func (e *Error) Temporary() bool {
+	return e.Code == RetryNow || e.Code == RetryLater
+}
+
+// parseError builds the Error of a non-200 response. body is the JSON APNs sends with failures:
+// {"reason": "...", "timestamp": <milliseconds>}.
+func parseError(statusCode int, apnsId string, body []byte) (*Error, error) {
+	data := new(struct {
+		Reason    string `json:"reason"`
+		Timestamp int64  `json:"timestamp"`
+	})
+	if err := json.Unmarshal(body, data); err != nil {
+		return nil, err
+	}
+	if data.Reason == "" {
+		return nil, fmt.Errorf("no reason")
+	}
+
+	e := &Error{
+		Reason:     Reason(data.Reason),
+		StatusCode: statusCode,
+		ApnsId:     apnsId,
+	}
+	if data.Timestamp > 0 {
+		e.Timestamp = time.Unix(0, data.Timestamp*int64(time.Millisecond))
+	}
+
+	e.Code = e.Reason.Code()
+	if e.Code == FailNow && statusCode >= 500 {
+		e.Code = RetryLater
+	}
+	return e, nil
+}
@@ -1,15 +1,16 @@
 package apns
 
-type alert struct {
+// Alert is the alert dictionary of the aps payload.
+type Alert struct {
 	// The title of the notification. Apple Watch displays this string in the short look notification interface.
 	// Specify a string that is quickly understood by the user.
 	Title string `json:"title,omitempty"`
 
 	// Additional information that explains the purpose of the notification.
-	Subitle string `json:"subtitle,omitempty"`
+	Subtitle string `json:"subtitle,omitempty"`
 
 	// The content of the alert message.
-	Body string `json:"body"`
+	Body string `json:"body,omitempty"`
 
 	// Safari only.
 	Action string `json:"action,omitempty"`
@@ -54,17 +55,50 @@ type alert struct {
 	LocArgs *[]string `json:"loc-args,omitempty"`
 }
 
-type aps struct {
+// CriticalSound is the sound dictionary of a critical alert.
+type CriticalSound struct {
+	// 1 plays the sound as a critical alert.
+	Critical int `json:"critical"`
+
+	// The name of a sound file in your app’s main bundle or in the Library/Sounds folder of your app’s
+	// container directory, or "default".
+	Name string `json:"name"`
+
+	// The volume of the sound, from 0 (silent) to 1 (full volume). Nil plays it at full volume.
+	Volume *float64 `json:"volume,omitempty"`
+}
+
+// InterruptionLevel is the interruption-level of an alert.
+type InterruptionLevel string
+
+const (
+	// Added to the notification list without lighting up the screen or playing a sound.
+	InterruptionPassive = InterruptionLevel("passive")
+
+	// Presented immediately, lights up the screen and can play a sound. The default.
+	InterruptionActive = InterruptionLevel("active")
+
+	// Presented immediately, also during Focus and scheduled summary delivery. Requires the Time Sensitive
+	// Notifications capability.
+	InterruptionTimeSensitive = InterruptionLevel("time-sensitive")
+
+	// Presented immediately, lights up the screen and plays a sound bypassing the mute switch and Focus.
+	// Requires the critical alerts entitlement.
+	InterruptionCritical = InterruptionLevel("critical")
+)
+
+// Aps is the aps dictionary, the part of the payload APNs and the system act on.
+type Aps struct {
 	// The information for displaying an alert
-	Alert *alert `json:"alert,omitempty"`
+	Alert *Alert `json:"alert,omitempty"`
 
 	// The number to display in a badge on your app’s icon. Specify 0 to remove the current badge, if any.
 	Badge *int `json:"badge,omitempty"`
 
 	// The name of a sound file in your app’s main bundle or in the Library/Sounds folder of your app’s
-	// container directory. Specify the string "default" to play the system sound. Use this key for
-	// regular notifications.
-	Sound string `json:"sound,omitempty"`
+	// container directory. Specify the string "default" to play the system sound. Use a string for
+	// regular notifications, and a *CriticalSound for critical alerts.
+	Sound interface{} `json:"sound,omitempty"`
 
 	// An app-specific identifier for grouping related notifications. This value corresponds to the
 	// threadIdentifier property in the UNNotificationContent object.
@@ -88,6 +122,46 @@ type aps struct {
 	// object's targetContentIdentifier property.
 	TargetContentId string `json:"target-content-id,omitempty"`
 
+	// The importance and delivery timing of the notification: passive, active (the default), time-sensitive
+	// or critical. Time-sensitive and critical notifications break through Focus; critical ones also play
+	// their sound when the device is muted and require an entitlement from Apple.
+	InterruptionLevel InterruptionLevel `json:"interruption-level,omitempty"`
+
+	// A number from 0 to 1 the system uses to sort the notifications of your app in the notification
+	// summary. The highest score gets featured.
+	RelevanceScore *float64 `json:"relevance-score,omitempty"`
+
+	// The criteria the system evaluates to decide whether the notification is shown in the current Focus.
+	FilterCriteria string `json:"filter-criteria,omitempty"`
+
+	// Widgets and controls only. True asks the system to reload the widgets or controls of the app.
+	ContentChanged bool `json:"content-changed,omitempty"`
+
 	// Safari only
 	UrlArgs *[]string `json:"url-args,omitempty"`
+
+	// Live Activities only. The UNIX time in seconds at which the update was generated. The system ignores
+	// an update with a timestamp older than the one it already shows.
+	Timestamp int64 `json:"timestamp,omitempty"`
+
+	// Live Activities only. The action: start, update or end.
+	Event LiveActivityEvent `json:"event,omitempty"`
+
+	// Live Activities only. The updated dynamic content; it must match the ContentState of the activity
+	// attributes type in your app.
+	ContentState interface{} `json:"content-state,omitempty"`
+
+	// Live Activities only. The UNIX time in seconds at which the Live Activity becomes outdated and the
+	// system shows it as stale.
+	StaleDate int64 `json:"stale-date,omitempty"`
+
+	// Live Activities only. The UNIX time in seconds at which an ended Live Activity is removed from the
+	// Lock Screen. Without it the system removes it after up to four hours.
+	DismissalDate int64 `json:"dismissal-date,omitempty"`
+
+	// Live Activities only, start events. The name of the ActivityAttributes type in your app.
+	AttributesType string `json:"attributes-type,omitempty"`
+
+	// Live Activities only, start events. The static attributes of the activity.
+	Attributes interface{} `json:"attributes,omitempty"`
 }
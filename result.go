@@ -1,8 +1,33 @@
 package apns
 
+import (
+	"time"
+)
+
 type Result struct {
-	Code          ResultCode
-	Error         error
+	Code  ResultCode
+	Error error
+
+	// The apns-id of the notification: Headers.Id, generated if it was empty, or the one APNs returned.
+	ApnsId string
+
+	// The apns-unique-id APNs returns in the development environment. Use it to look the notification up
+	// in the Push Notifications Console delivery log.
+	ApnsUniqueId string
+
+	// The HTTP status of the response, 0 if no response was received.
+	StatusCode int
+
+	// The time from sending the request to reading the whole response, for the last attempt.
+	Latency time.Duration
+
+	// The number of times the push was sent, more than 1 if Config.Retry retried it.
+	Attempts int
+
+	// For InvalidToken, the time at which APNs confirmed the device token was no longer valid for
+	// the topic. Zero if APNs did not report it.
+	InvalidSince time.Time
+
 	DebugRequest  string
 	DebugResponse string
 }
@@ -15,4 +40,12 @@ const (
 	RetryNow
 	RetryLater
 	InvalidConfig
+
+	// The context passed to SendContext was canceled or its deadline exceeded
+	// before the push was delivered. Error wraps ctx.Err().
+	Canceled
+
+	// The device token is no longer valid for the topic (Unregistered, ExpiredToken) and should not be used
+	// again, unless the app registered it again after Result.InvalidSince.
+	InvalidToken
 )
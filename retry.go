@@ -0,0 +1,125 @@
+package apns
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy makes Config.Send retry pushes that failed with RetryNow or RetryLater. FailNow,
+// InvalidConfig and InvalidToken results are never retried.
+type RetryPolicy struct {
+	// The maximum number of attempts, the first one included. Defaults to 3.
+	MaxAttempts int
+
+	// The wait before the first RetryLater retry, doubled after every attempt up to MaxBackoff.
+	// Default to 1 second and 1 minute.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// The fraction of every wait that is randomized, so retries of many pushes do not arrive at once.
+	// 0.2 makes a 10 second wait anything from 8 to 12 seconds. Defaults to 0.2; use a negative value
+	// to disable.
+	Jitter float64
+
+	// The maximum time spent on a push, all attempts and waits included. Zero means no limit other than
+	// the context passed to SendContext.
+	Deadline time.Duration
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the wait before the attempt following n failed ones.
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	min, max := p.MinBackoff, p.MaxBackoff
+	if min <= 0 {
+		min = time.Second
+	}
+	if max <= 0 {
+		max = time.Minute
+	}
+
+	d := min
+	for i := 1; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	jitter := p.Jitter
+	if jitter == 0 {
+		jitter = 0.2
+	}
+	if jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * jitter * float64(d))
+	}
+	return d
+}
+
+func (c *Config) sendWithRetry(ctx context.Context, url string, req interface{}, headers Headers, client *http.Client) (r Result) {
+	p := c.Retry
+
+	if p.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Deadline)
+		defer cancel()
+	}
+
+	// every attempt is the same notification
+	if headers.Id == "" {
+		headers.Id = newUUID()
+	}
+
+	tokenReset := false
+	retriedNow := false
+	waits := 0
+	for attempt := 1; ; attempt++ {
+		r = c.send(ctx, url, req, headers, client)
+		r.Attempts = attempt
+
+		if r.Code != RetryNow && r.Code != RetryLater {
+			return
+		}
+		if attempt >= p.maxAttempts() {
+			return
+		}
+
+		var wait time.Duration
+		switch {
+		case errors.Is(r.Error, ExpiredProviderToken) && r.Code == RetryNow && !tokenReset:
+			// send already dropped the token and the next attempt gets a new one. A token signed
+			// less than minTokenRefresh ago is kept, send makes that RetryLater.
+			tokenReset = true
+		case r.Code == RetryNow && !retriedNow:
+			retriedNow = true
+		default:
+			waits++
+			wait = p.backoff(waits)
+		}
+
+		if d, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(d) {
+			return
+		}
+
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				r.Code = Canceled
+				r.Error = errors.Wrap(ctx.Err(), "retry wait fail")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package apns_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tada-team/apns"
+	"github.com/tada-team/apns/apnstest"
+)
+
+// After ExpiredProviderToken a Config that may sign again retries at once with a new token. A Config
+// that signed its token less than 20 minutes ago has to keep it, so it retries later with the same one.
+func TestRetryExpiredProviderToken(t *testing.T) {
+	const backoff = 100 * time.Millisecond
+
+	for _, tt := range []struct {
+		name      string
+		fromStore bool // the token was signed by another Config sharing the TokenStore
+		newToken  bool
+	}{
+		{name: "signed recently", newToken: false},
+		{name: "loaded from store", fromStore: true, newToken: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, srv := newTestConfig(t)
+			signer.TokenStore = apns.NewMemoryTokenStore()
+
+			c := signer
+			if tt.fromStore {
+				c = &apns.Config{
+					Bundle:      signer.Bundle,
+					KeyId:       signer.KeyId,
+					TeamId:      signer.TeamId,
+					TokenSigner: signer.TokenSigner,
+					TokenStore:  signer.TokenStore,
+				}
+				srv.Configure(c)
+				t.Cleanup(func() { c.Close() })
+
+				if r := (apns.AlertPush{Body: "Hi", BackgroundPush: apns.BackgroundPush{Token: testToken}}).Send(signer, nil); r.Code != apns.Ok {
+					t.Fatal(r.Error)
+				}
+				srv.Reset()
+			}
+			c.Retry = &apns.RetryPolicy{MinBackoff: backoff, Jitter: -1}
+
+			srv.Enqueue(apnstest.Reject(apns.ExpiredProviderToken))
+			start := time.Now()
+			r := apns.AlertPush{Body: "Hi", BackgroundPush: apns.BackgroundPush{Token: testToken}}.Send(c, nil)
+			if r.Code != apns.Ok {
+				t.Fatalf("code: got %v, %v", r.Code, r.Error)
+			}
+			if r.Attempts != 2 {
+				t.Errorf("attempts: got %d, want 2", r.Attempts)
+			}
+
+			reqs := srv.Requests()
+			if len(reqs) != 2 {
+				t.Fatalf("requests: got %d, want 2", len(reqs))
+			}
+			first, second := reqs[0].Header.Get("Authorization"), reqs[1].Header.Get("Authorization")
+			if newToken := first != second; newToken != tt.newToken {
+				t.Errorf("new token: got %v, want %v", newToken, tt.newToken)
+			}
+			if waited := time.Since(start) >= backoff; waited == tt.newToken {
+				t.Errorf("waited for backoff: got %v, want %v", waited, !tt.newToken)
+			}
+		})
+	}
+}
+
+// Only the first RetryNow is retried straight away, later ones back off like RetryLater.
+func TestRetryBackoff(t *testing.T) {
+	const backoff = 50 * time.Millisecond
+
+	for _, tt := range []struct {
+		name     string
+		reasons  []apns.Reason
+		wantWait time.Duration
+	}{
+		{name: "retry now once", reasons: []apns.Reason{apns.IdleTimeout}, wantWait: 0},
+		{name: "retry now again", reasons: []apns.Reason{apns.IdleTimeout, apns.IdleTimeout, apns.IdleTimeout}, wantWait: backoff + 2*backoff},
+		{name: "retry later", reasons: []apns.Reason{apns.ServiceUnavailable, apns.ServiceUnavailable}, wantWait: backoff + 2*backoff},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := newTestConfig(t)
+			c.Retry = &apns.RetryPolicy{MaxAttempts: len(tt.reasons) + 1, MinBackoff: backoff, Jitter: -1}
+			for _, reason := range tt.reasons {
+				srv.Enqueue(apnstest.Reject(reason))
+			}
+
+			start := time.Now()
+			r := apns.AlertPush{Body: "Hi", BackgroundPush: apns.BackgroundPush{Token: testToken}}.Send(c, nil)
+			elapsed := time.Since(start)
+			if r.Code != apns.Ok || r.Attempts != len(tt.reasons)+1 {
+				t.Fatalf("code %v after %d attempts: %v", r.Code, r.Attempts, r.Error)
+			}
+			if elapsed < tt.wantWait || tt.wantWait == 0 && elapsed >= backoff {
+				t.Errorf("waited %v, want %v", elapsed, tt.wantWait)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package apns
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Router keeps a Config per app and sends each push with the one of its bundle ID, so a single client
+// can serve several apps of several teams. Token-based apps of the same team and signing key sharing
+// the Router host also share HTTP/2 connections and provider tokens.
+type Router struct {
+	Host      string
+	Transport TransportOpts
+
+	mux     sync.Mutex
+	configs map[string]*Config
+	pools   map[string]*connPool
+	tokens  *MemoryTokenStore
+}
+
+// Add registers the Config of an app under its Bundle, replacing a previous one. Host defaults to the
+// Router host.
+func (r *Router) Add(c *Config) error {
+	if c.Bundle == "" {
+		return errors.New("empty bundle")
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.configs == nil {
+		r.configs = make(map[string]*Config)
+		r.pools = make(map[string]*connPool)
+		r.tokens = NewMemoryTokenStore()
+	}
+
+	if c.Host == "" {
+		c.Host = r.Host
+	}
+
+	if !c.usesCert() && c.Host == r.Host {
+		// APNs rejects tokens of another key on a connection with UnrelatedKeyIdInToken
+		key := c.TeamId + "/" + c.KeyId
+		pool, ok := r.pools[key]
+		if !ok {
+			pool = newConnPool(hostAddr(r.Host), r.Transport, &tls.Config{RootCAs: r.Transport.RootCAs})
+			r.pools[key] = pool
+		}
+
+		c.mux.Lock()
+		c.client = &http.Client{Transport: pool, Timeout: r.Transport.ResponseTimeout}
+		c.mux.Unlock()
+
+		if c.TokenStore == nil {
+			c.TokenStore = r.tokens
+		}
+	}
+
+	if old, ok := r.configs[c.Bundle]; ok && old != c {
+		old.Close()
+	}
+	r.configs[c.Bundle] = c
+	return nil
+}
+
+// Config returns the Config registered for bundle.
+func (r *Router) Config(bundle string) (*Config, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	c, ok := r.configs[bundle]
+	if !ok {
+		return nil, errors.Errorf("unknown bundle: %s", bundle)
+	}
+	return c, nil
+}
+
+// Send sends a push with the Config registered for bundle. An unknown bundle fails with InvalidConfig.
+func (r *Router) Send(ctx context.Context, bundle string, p Push, h *Headers) (res Result) {
+	c, err := r.Config(bundle)
+	if err != nil {
+		res.Code = InvalidConfig
+		res.Error = err
+		return
+	}
+	return p.SendContext(ctx, c, h)
+}
+
+// SendPayload sends a payload to a device token with the Config registered for bundle, like
+// Config.SendPayload. An unknown bundle fails with InvalidConfig.
+func (r *Router) SendPayload(ctx context.Context, bundle, token string, p *Payload, h Headers) (res Result) {
+	c, err := r.Config(bundle)
+	if err != nil {
+		res.Code = InvalidConfig
+		res.Error = err
+		return
+	}
+	return c.SendPayload(ctx, token, p, h)
+}
+
+// Bundles returns the bundle IDs of all registered apps.
+func (r *Router) Bundles() []string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	res := make([]string, 0, len(r.configs))
+	for k := range r.configs {
+		res = append(res, k)
+	}
+	return res
+}
+
+// Remove unregisters the app with bundle and closes its own connections.
+func (r *Router) Remove(bundle string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	c, ok := r.configs[bundle]
+	if !ok {
+		return nil
+	}
+	delete(r.configs, bundle)
+	return c.Close()
+}
+
+// Close closes the connections of every registered app.
+func (r *Router) Close() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	var res error
+	for _, c := range r.configs {
+		if err := c.Close(); err != nil && res == nil {
+			res = err
+		}
+	}
+	for _, p := range r.pools {
+		if err := p.Close(); err != nil && res == nil {
+			res = err
+		}
+	}
+	r.configs = nil
+	r.pools = nil
+	return res
+}
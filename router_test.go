@@ -0,0 +1,31 @@
+package apns
+
+import "testing"
+
+func TestRouterSharedPool(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		teamA, keyA string
+		teamB, keyB string
+		shared      bool
+	}{
+		{name: "same key", teamA: "TEAM", keyA: "KEY1", teamB: "TEAM", keyB: "KEY1", shared: true},
+		{name: "other key", teamA: "TEAM", keyA: "KEY1", teamB: "TEAM", keyB: "KEY2"},
+		{name: "other team", teamA: "TEAM1", keyA: "KEY", teamB: "TEAM2", keyB: "KEY"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Router{Host: "api.sandbox.push.apple.com"}
+			a := &Config{Bundle: "com.example.a", TeamId: tt.teamA, KeyId: tt.keyA}
+			b := &Config{Bundle: "com.example.b", TeamId: tt.teamB, KeyId: tt.keyB}
+			if err := r.Add(a); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Add(b); err != nil {
+				t.Fatal(err)
+			}
+			if shared := a.client.Transport == b.client.Transport; shared != tt.shared {
+				t.Errorf("shared pool: got %v, want %v", shared, tt.shared)
+			}
+		})
+	}
+}
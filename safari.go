@@ -20,7 +20,6 @@ import (
 	"github.com/aai/gocrypto/pkcs7"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/pkcs12"
 )
 
 var icons = []string{
@@ -34,6 +33,7 @@ var icons = []string{
 
 type SafariOpts struct {
 	Cert          []byte `json:"-"`
+	CertPassword  string `json:"-"`
 	IconsPath     string `json:"-"`
 	AppleCertPath string `json:"-"`
 
@@ -158,9 +158,13 @@ func (opts SafariOpts) websiteJson() ([]byte, error) {
 		return nil, errors.Wrap(err, "add to zip fail")
 	}
 
-	key, cert, err := pkcs12.Decode(opts.Cert, "")
+	key, cert, _, err := decodePKCS12(opts.Cert, opts.CertPassword)
 	if err != nil {
-		return nil, errors.Wrap(err, "pkcs12.Decode")
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not RSA private key")
 	}
 
 	appleCert, err := opts.appleCert()
@@ -168,7 +172,7 @@ func (opts SafariOpts) websiteJson() ([]byte, error) {
 		return nil, errors.Wrap(err, "appleCert fail")
 	}
 
-	sign, err := pkcs7.Sign2(bytes.NewReader(manifestBytes), cert, key.(*rsa.PrivateKey), appleCert)
+	sign, err := pkcs7.Sign2(bytes.NewReader(manifestBytes), cert, rsaKey, appleCert)
 	if err != nil {
 		return nil, errors.Wrap(err, "sign fail")
 	}
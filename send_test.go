@@ -0,0 +1,309 @@
+package apns_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tada-team/apns"
+	"github.com/tada-team/apns/apnstest"
+)
+
+const testToken = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// newTestConfig returns a token-authenticated Config pointed at a new apnstest.Server that verifies its
+// provider tokens.
+func newTestConfig(t *testing.T) (*apns.Config, *apnstest.Server) {
+	t.Helper()
+
+	signer, err := apns.GenerateMemorySigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := signer.PublicKeyPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := apnstest.NewServer()
+	if err := srv.SetPublicKey(pub, "KEYID", "TEAMID"); err != nil {
+		t.Fatal(err)
+	}
+	c := &apns.Config{
+		Bundle:      "com.example.app",
+		KeyId:       "KEYID",
+		TeamId:      "TEAMID",
+		TokenSigner: signer,
+	}
+	srv.Configure(c)
+
+	t.Cleanup(func() {
+		c.Close()
+		srv.Close()
+	})
+	return c, srv
+}
+
+func TestSend(t *testing.T) {
+	unregistered := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+
+	otherKey, err := apns.GenerateMemorySigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, err := otherKey.PublicKeyPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		setup      func(t *testing.T, srv *apnstest.Server)
+		retry      *apns.RetryPolicy
+		wantCode   apns.ResultCode
+		wantReason apns.Reason
+		wantStatus int
+		requests   int
+	}{
+		{
+			name:       "ok",
+			wantCode:   apns.Ok,
+			wantStatus: http.StatusOK,
+			requests:   1,
+		},
+		{
+			name: "unregistered",
+			setup: func(t *testing.T, srv *apnstest.Server) {
+				srv.Enqueue(apnstest.Reject(apns.Unregistered).At(unregistered))
+			},
+			wantCode:   apns.InvalidToken,
+			wantReason: apns.Unregistered,
+			wantStatus: http.StatusGone,
+			requests:   1,
+		},
+		{
+			name: "too many requests",
+			setup: func(t *testing.T, srv *apnstest.Server) {
+				srv.Enqueue(apnstest.Reject(apns.TooManyRequests))
+			},
+			wantCode:   apns.RetryLater,
+			wantReason: apns.TooManyRequests,
+			wantStatus: http.StatusTooManyRequests,
+			requests:   1,
+		},
+		{
+			name: "internal server error",
+			setup: func(t *testing.T, srv *apnstest.Server) {
+				srv.Enqueue(apnstest.Reject(apns.InternalServerError))
+			},
+			wantCode:   apns.RetryLater,
+			wantReason: apns.InternalServerError,
+			wantStatus: http.StatusInternalServerError,
+			requests:   1,
+		},
+		{
+			name: "expired provider token retried",
+			setup: func(t *testing.T, srv *apnstest.Server) {
+				srv.Enqueue(apnstest.Reject(apns.ExpiredProviderToken))
+			},
+			retry:      &apns.RetryPolicy{MinBackoff: time.Millisecond, Jitter: -1},
+			wantCode:   apns.Ok,
+			wantStatus: http.StatusOK,
+			requests:   2,
+		},
+		{
+			name: "wrong public key",
+			setup: func(t *testing.T, srv *apnstest.Server) {
+				if err := srv.SetPublicKey(otherPub, "KEYID", "TEAMID"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			retry:      &apns.RetryPolicy{MinBackoff: time.Millisecond, Jitter: -1},
+			wantCode:   apns.InvalidConfig,
+			wantReason: apns.InvalidProviderToken,
+			wantStatus: http.StatusForbidden,
+			requests:   1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := newTestConfig(t)
+			c.Retry = tt.retry
+
+			var invalid []string
+			c.OnInvalidToken = func(token string, reason apns.Reason, since time.Time) {
+				invalid = append(invalid, token)
+				if reason != tt.wantReason {
+					t.Errorf("OnInvalidToken reason: got %s, want %s", reason, tt.wantReason)
+				}
+				if !since.Equal(unregistered) {
+					t.Errorf("OnInvalidToken since: got %v, want %v", since, unregistered)
+				}
+			}
+			if tt.setup != nil {
+				tt.setup(t, srv)
+			}
+
+			r := apns.AlertPush{Title: "Hi", Body: "New message", BackgroundPush: apns.BackgroundPush{Token: testToken}}.Send(c, nil)
+			if r.Code != tt.wantCode {
+				t.Fatalf("code: got %v, want %v (%v)", r.Code, tt.wantCode, r.Error)
+			}
+			if tt.wantReason != "" && !errors.Is(r.Error, tt.wantReason) {
+				t.Errorf("err: got %v, want %s", r.Error, tt.wantReason)
+			}
+			if r.StatusCode != tt.wantStatus {
+				t.Errorf("status: got %d, want %d", r.StatusCode, tt.wantStatus)
+			}
+
+			if tt.wantCode == apns.InvalidToken {
+				if !r.InvalidSince.Equal(unregistered) {
+					t.Errorf("InvalidSince: got %v, want %v", r.InvalidSince, unregistered)
+				}
+				if len(invalid) != 1 || invalid[0] != testToken {
+					t.Errorf("OnInvalidToken: got %v", invalid)
+				}
+			} else if len(invalid) > 0 {
+				t.Errorf("OnInvalidToken called for %v", invalid)
+			}
+
+			reqs := srv.Requests()
+			if len(reqs) != tt.requests {
+				t.Fatalf("requests: got %d, want %d", len(reqs), tt.requests)
+			}
+			for _, req := range reqs {
+				if req.Token != testToken || req.Topic != "com.example.app" || req.PushType != "alert" {
+					t.Errorf("request: token %s, topic %s, push type %s", req.Token, req.Topic, req.PushType)
+				}
+				if req.Id != r.ApnsId {
+					t.Errorf("apns-id: got %s, want %s", req.Id, r.ApnsId)
+				}
+			}
+			last := reqs[len(reqs)-1]
+			if last.Response.StatusCode != tt.wantStatus {
+				t.Errorf("recorded status: got %d, want %d", last.Response.StatusCode, tt.wantStatus)
+			}
+			if tt.wantReason != apns.InvalidProviderToken && last.Claims["iss"] != "TEAMID" {
+				t.Errorf("recorded claims: got %v", last.Claims)
+			}
+		})
+	}
+}
+
+func TestSendPushTypes(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		push     apns.Push
+		pushType string
+		topic    string
+		wantAps  string
+		wantPrio string
+	}{
+		{name: "location", push: apns.LocationPush{Token: testToken}, pushType: "location", topic: "com.example.app.location-query", wantAps: `{}`},
+		{name: "widgets", push: apns.WidgetsPush{Token: testToken}, pushType: "widgets", topic: "com.example.app.push-type.widgets", wantAps: `{"content-changed":true}`},
+		{name: "controls", push: apns.ControlsPush{Token: testToken}, pushType: "controls", topic: "com.example.app.push-type.controls", wantAps: `{"content-changed":true}`},
+		{name: "push to talk", push: apns.PushToTalkPush{Token: testToken}, pushType: "pushtotalk", topic: "com.example.app.voip-ptt", wantAps: `{}`, wantPrio: "10"},
+		{name: "background", push: apns.BackgroundPush{Token: testToken}, pushType: "background", topic: "com.example.app", wantAps: `{"content-available":1}`},
+		{name: "voip", push: apns.VoipPush{Body: "Hi", Token: testToken}, pushType: "voip", topic: "com.example.app.voip", wantAps: `{"alert":{"body":"Hi"}}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := newTestConfig(t)
+			c.Validate = true
+
+			h := new(apns.Headers)
+			if r := tt.push.SendContext(context.Background(), c, h); r.Code != apns.Ok {
+				t.Fatalf("code: got %v (%v)", r.Code, r.Error)
+			}
+			if h.PushType != "" || h.Priority != 0 || h.Topic != "" {
+				t.Errorf("headers changed: %+v", *h)
+			}
+
+			reqs := srv.Requests()
+			if len(reqs) != 1 {
+				t.Fatalf("requests: got %d, want 1", len(reqs))
+			}
+			req := reqs[0]
+			if req.PushType != tt.pushType || req.Topic != tt.topic {
+				t.Errorf("push type %s, topic %s", req.PushType, req.Topic)
+			}
+			if prio := req.Header.Get("apns-priority"); prio != tt.wantPrio {
+				t.Errorf("priority: got %q, want %q", prio, tt.wantPrio)
+			}
+			var body struct {
+				Aps json.RawMessage `json:"aps"`
+			}
+			if err := json.Unmarshal(req.Body, &body); err != nil {
+				t.Fatal(err)
+			}
+			if string(body.Aps) != tt.wantAps {
+				t.Errorf("aps: got %s, want %s", body.Aps, tt.wantAps)
+			}
+		})
+	}
+}
+
+func TestRouterSend(t *testing.T) {
+	signer, err := apns.GenerateMemorySigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := signer.PublicKeyPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := apnstest.NewServer()
+	defer srv.Close()
+	if err := srv.SetPublicKey(pub, "KEYID", "TEAMID"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &apns.Router{Host: srv.Host, Transport: apns.TransportOpts{RootCAs: srv.RootCAs}}
+	defer r.Close()
+	for _, bundle := range []string{"com.example.a", "com.example.b"} {
+		if err := r.Add(&apns.Config{Bundle: bundle, KeyId: "KEYID", TeamId: "TEAMID", TokenSigner: signer}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name     string
+		bundle   string
+		payload  bool
+		wantCode apns.ResultCode
+	}{
+		{name: "push a", bundle: "com.example.a", wantCode: apns.Ok},
+		{name: "push b", bundle: "com.example.b", wantCode: apns.Ok},
+		{name: "payload b", bundle: "com.example.b", payload: true, wantCode: apns.Ok},
+		{name: "unknown bundle", bundle: "com.example.c", wantCode: apns.InvalidConfig},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.Reset()
+
+			var res apns.Result
+			if tt.payload {
+				res = r.SendPayload(ctx, tt.bundle, testToken, apns.NewPayload().AlertBody("Hi"), apns.Headers{})
+			} else {
+				res = r.Send(ctx, tt.bundle, apns.AlertPush{Body: "Hi", BackgroundPush: apns.BackgroundPush{Token: testToken}}, nil)
+			}
+			if res.Code != tt.wantCode {
+				t.Fatalf("code: got %v, want %v (%v)", res.Code, tt.wantCode, res.Error)
+			}
+
+			reqs := srv.Requests()
+			if tt.wantCode != apns.Ok {
+				if len(reqs) != 0 {
+					t.Errorf("requests: got %d, want 0", len(reqs))
+				}
+				return
+			}
+			if len(reqs) != 1 || reqs[0].Topic != tt.bundle {
+				t.Errorf("requests: got %d, want 1 with topic %s", len(reqs), tt.bundle)
+			}
+		})
+	}
+	if n := srv.Connections(); n != 1 {
+		t.Errorf("connections: got %d, want 1 shared", n)
+	}
+}
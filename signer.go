@@ -0,0 +1,158 @@
+package apns
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// TokenSigner produces the ES256 signature of a provider token. Implement it to keep the .p8 key
+// in an HSM or a key service instead of passing its bytes in Config.AuthKey.
+type TokenSigner interface {
+	// SignES256 signs the JWT signing input (base64url header "." base64url claims) with ECDSA P-256
+	// and SHA-256 and returns the JWS signature: r and s as 32-byte big-endian integers, 64 bytes in total.
+	SignES256(ctx context.Context, signingInput string) ([]byte, error)
+}
+
+// cryptoSigner adapts a crypto.Signer holding a P-256 key to TokenSigner.
+type cryptoSigner struct {
+	crypto.Signer
+}
+
+func (s cryptoSigner) SignES256(ctx context.Context, signingInput string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := s.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	// crypto.Signer returns an ASN.1 signature for ECDSA keys, JWS wants raw r || s.
+	if len(sig) == 64 {
+		return sig, nil
+	}
+	var v struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(sig, &v); err != nil {
+		return nil, errors.Wrap(err, "signature parse fail")
+	}
+	out := make([]byte, 64)
+	rb, sb := v.R.Bytes(), v.S.Bytes()
+	if len(rb) > 32 || len(sb) > 32 {
+		return nil, fmt.Errorf("not P-256 signature")
+	}
+	copy(out[32-len(rb):32], rb)
+	copy(out[64-len(sb):], sb)
+	return out, nil
+}
+
+// MemorySigner is a TokenSigner and crypto.Signer that keeps the key in memory.
+// It is meant as a reference implementation and for tests.
+type MemorySigner struct {
+	key *ecdsa.PrivateKey
+}
+
+// NewMemorySigner parses a .p8 auth key.
+func NewMemorySigner(authKey []byte) (*MemorySigner, error) {
+	key, err := parseAuthKey(authKey)
+	if err != nil {
+		return nil, err
+	}
+	return &MemorySigner{key: key}, nil
+}
+
+// GenerateMemorySigner creates a signer with a fresh P-256 key.
+func GenerateMemorySigner() (*MemorySigner, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate key fail")
+	}
+	return &MemorySigner{key: key}, nil
+}
+
+func (s *MemorySigner) Public() crypto.PublicKey {
+	return &s.key.PublicKey
+}
+
+func (s *MemorySigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.key.Sign(rand, digest, opts)
+}
+
+func (s *MemorySigner) SignES256(ctx context.Context, signingInput string) ([]byte, error) {
+	return cryptoSigner{s}.SignES256(ctx, signingInput)
+}
+
+// PublicKeyPEM returns the public key in PKIX PEM form, as used to verify provider tokens.
+func (s *MemorySigner) PublicKeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// AuthKey returns the key in .p8 (PKCS#8 PEM) form.
+func (s *MemorySigner) AuthKey() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(s.key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func (c *Config) getTokenSigner() TokenSigner {
+	if c.TokenSigner != nil {
+		return c.TokenSigner
+	}
+	if c.Signer != nil {
+		return cryptoSigner{c.Signer}
+	}
+	return nil
+}
+
+func signToken(ctx context.Context, token *jwt.Token, signer TokenSigner) (string, error) {
+	input, err := token.SigningString()
+	if err != nil {
+		return "", err
+	}
+	sig, err := signer.SignES256(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	if len(sig) != 64 {
+		return "", fmt.Errorf("bad ES256 signature length: %d", len(sig))
+	}
+	return input + "." + jwt.EncodeSegment(sig), nil
+}
+
+func parseAuthKey(b []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("pem decode error")
+	}
+	pKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "p8 parse error")
+	}
+	pkey, ok := pKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not ECDSA private key")
+	}
+	return pkey, nil
+}
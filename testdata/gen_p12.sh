@@ -0,0 +1,24 @@
+#!/bin/sh
+# Regenerates the .p12 fixtures of pkcs12_test.go. Needs OpenSSL 3.
+set -e
+cd "$(dirname "$0")"
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+openssl req -x509 -newkey rsa:2048 -nodes -days 36500 -subj "/CN=Test CA" \
+	-keyout "$tmp/ca.key" -out "$tmp/ca.pem" 2>/dev/null
+openssl req -newkey rsa:2048 -nodes -subj "/UID=com.example.app/CN=Apple Push Services: com.example.app" \
+	-keyout "$tmp/leaf.key" -out "$tmp/leaf.csr" 2>/dev/null
+openssl x509 -req -in "$tmp/leaf.csr" -CA "$tmp/ca.pem" -CAkey "$tmp/ca.key" -CAcreateserial -days 36500 \
+	-out "$tmp/leaf.pem" 2>/dev/null
+
+export="openssl pkcs12 -export -inkey $tmp/leaf.key -in $tmp/leaf.pem -certfile $tmp/ca.pem"
+$export -passout pass:test -out p12_aes_sha256.p12
+$export -passout pass: -out p12_empty_password.p12
+$export -passout pass:test -legacy -out p12_legacy.p12
+$export -passout pass:test -certpbe NONE -out p12_plain_certs.p12
+
+# non-default MACs and ciphers, rejected by the decoder
+$export -passout pass:test -macalg sha384 -out p12_aes_sha384.p12
+$export -passout pass:test -macalg sha512 -out p12_aes_sha512.p12
+$export -passout pass:test -keypbe DES-EDE3-CBC -certpbe DES-EDE3-CBC -out p12_des3_pbes2.p12
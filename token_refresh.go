@@ -0,0 +1,103 @@
+package apns
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// TokenAge returns how long ago the current provider token was issued, or 0 if there is none yet.
+func (c *Config) TokenAge() time.Duration {
+	c.tokenMux.Lock()
+	defer c.tokenMux.Unlock()
+
+	if c.generated == nil {
+		return 0
+	}
+	return time.Since(*c.generated)
+}
+
+// StartTokenRefresh replaces the provider token in the background before it expires, so sends never
+// wait for signing and never use a token about to be rejected. It runs until Close.
+func (c *Config) StartTokenRefresh() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.refreshStop != nil || c.usesCert() {
+		return
+	}
+	stop := make(chan struct{})
+	c.refreshStop = stop
+	go c.refreshTokens(stop)
+}
+
+func (c *Config) stopTokenRefresh() {
+	if c.refreshStop != nil {
+		close(c.refreshStop)
+		c.refreshStop = nil
+	}
+}
+
+func (c *Config) refreshTokens(stop chan struct{}) {
+	for {
+		rotation := c.tokenRotation()
+
+		age := c.TokenAge()
+		wait := rotation - age
+		if age == 0 {
+			wait = 0
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		c.tokenMux.Lock()
+		_, err := c.getTokenLocked(ctx, rotation)
+		c.tokenMux.Unlock()
+		cancel()
+
+		if err != nil {
+			log.Println("apns: token refresh fail:", err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Minute):
+			}
+		} else if age := c.TokenAge(); age == 0 || age >= rotation {
+			// too early to sign again, see minTokenRefresh
+			select {
+			case <-stop:
+				return
+			case <-time.After(minTokenRefresh / 4):
+			}
+		}
+	}
+}
+
+// tokenRotation returns the jittered token age at which the refresher replaces the token.
+func (c *Config) tokenRotation() time.Duration {
+	rotation := c.TokenRotation
+	if rotation <= 0 {
+		rotation = 45 * time.Minute
+	}
+	jitter := c.TokenRotationJitter
+	if jitter <= 0 {
+		jitter = 5 * time.Minute
+	}
+
+	d := rotation + time.Duration(rand.Int63n(int64(jitter)))
+	if d < minTokenRefresh {
+		d = minTokenRefresh
+	}
+	if d > tokenLifetime {
+		d = tokenLifetime
+	}
+	return d
+}
@@ -0,0 +1,97 @@
+package apns
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// StoredToken is a provider token shared through a TokenStore.
+type StoredToken struct {
+	Value  string    `json:"value"`
+	Issued time.Time `json:"issued"`
+}
+
+// TokenStore shares provider tokens between processes using the same key, so a fleet of workers signs
+// one token per key instead of one per process and does not hit TooManyProviderTokenUpdates.
+type TokenStore interface {
+	// Get returns the token stored for key, or nil if there is none or it has expired.
+	Get(ctx context.Context, key string) (*StoredToken, error)
+
+	// Set stores the token for key for ttl.
+	Set(ctx context.Context, key string, token StoredToken, ttl time.Duration) error
+
+	// Delete removes the token stored for key, but only if its value is still value. A token refreshed
+	// by another process in the meantime is kept.
+	Delete(ctx context.Context, key string, value string) error
+
+	// Lock takes the refresh lock for key, blocking until it is free or ctx is done. Only the holder
+	// of the lock signs a new token. The returned function releases the lock.
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+// MemoryTokenStore is a TokenStore for Configs living in the same process.
+type MemoryTokenStore struct {
+	mux    sync.Mutex
+	tokens map[string]memoryToken
+	locks  map[string]chan struct{}
+}
+
+type memoryToken struct {
+	token   StoredToken
+	expires time.Time
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens: make(map[string]memoryToken),
+		locks:  make(map[string]chan struct{}),
+	}
+}
+
+func (s *MemoryTokenStore) Get(ctx context.Context, key string) (*StoredToken, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	v, ok := s.tokens[key]
+	if !ok || time.Now().After(v.expires) {
+		return nil, nil
+	}
+	token := v.token
+	return &token, nil
+}
+
+func (s *MemoryTokenStore) Set(ctx context.Context, key string, token StoredToken, ttl time.Duration) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.tokens[key] = memoryToken{token: token, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryTokenStore) Delete(ctx context.Context, key string, value string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if v, ok := s.tokens[key]; ok && v.token.Value == value {
+		delete(s.tokens, key)
+	}
+	return nil
+}
+
+func (s *MemoryTokenStore) Lock(ctx context.Context, key string) (func(), error) {
+	s.mux.Lock()
+	lock, ok := s.locks[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		s.locks[key] = lock
+	}
+	s.mux.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,196 @@
+package apns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// FileTokenStore is a TokenStore for processes sharing a directory, e.g. workers on one host.
+// Tokens are kept in <Dir>/<key>.json and the refresh lock is a <Dir>/<key>.lock file, released under
+// short-lived <key>.lock.<owner>.<n> guard files.
+type FileTokenStore struct {
+	Dir string
+
+	// A lock file older than this is considered left over by a crashed process and is removed.
+	// Defaults to 30 seconds.
+	StaleLock time.Duration
+
+	// How often a busy lock is retried. Defaults to 50 milliseconds.
+	PollInterval time.Duration
+}
+
+type fileToken struct {
+	StoredToken
+	Expires time.Time `json:"expires"`
+}
+
+func (s *FileTokenStore) path(key, ext string) string {
+	return filepath.Join(s.Dir, unsafeFilename.ReplaceAllString(key, "_")+ext)
+}
+
+func (s *FileTokenStore) Get(ctx context.Context, key string) (*StoredToken, error) {
+	b, err := ioutil.ReadFile(s.path(key, ".json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read token fail")
+	}
+
+	v := new(fileToken)
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, errors.Wrap(err, "json fail")
+	}
+	if time.Now().After(v.Expires) {
+		return nil, nil
+	}
+	return &v.StoredToken, nil
+}
+
+func (s *FileTokenStore) Set(ctx context.Context, key string, token StoredToken, ttl time.Duration) error {
+	b, err := json.Marshal(fileToken{StoredToken: token, Expires: time.Now().Add(ttl)})
+	if err != nil {
+		return errors.Wrap(err, "json fail")
+	}
+
+	// write a temporary file and rename it, so readers never see a partial token
+	f, err := ioutil.TempFile(s.Dir, ".token-")
+	if err != nil {
+		return errors.Wrap(err, "create temp file fail")
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return errors.Wrap(err, "write token fail")
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "write token fail")
+	}
+	if err := os.Rename(f.Name(), s.path(key, ".json")); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "rename token fail")
+	}
+	return nil
+}
+
+// Delete holds the lock of key while it compares and removes the token, so a token another process
+// stores under the lock in the meantime is never removed.
+func (s *FileTokenStore) Delete(ctx context.Context, key string, value string) error {
+	unlock, err := s.Lock(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	v, err := s.Get(ctx, key)
+	if err != nil || v == nil || v.Value != value {
+		return err
+	}
+	if err := os.Remove(s.path(key, ".json")); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "remove token fail")
+	}
+	return nil
+}
+
+func (s *FileTokenStore) staleLock() time.Duration {
+	if s.StaleLock <= 0 {
+		return 30 * time.Second
+	}
+	return s.StaleLock
+}
+
+// Lock creates <key>.lock holding a random owner id. The lock file is only ever removed by its owner or,
+// once it is older than StaleLock, by a process taking it over, and either of them first has to create
+// the release guard of that owner id, see releaseLock. So exactly one process removes a given lock file,
+// and never a newer lock created after it.
+func (s *FileTokenStore) Lock(ctx context.Context, key string) (func(), error) {
+	name := s.path(key, ".lock")
+	owner := newUUID()
+
+	pollInterval := s.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = 50 * time.Millisecond
+	}
+
+	for {
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = f.WriteString(owner)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(name)
+				return nil, errors.Wrap(err, "write lock fail")
+			}
+			return func() { s.releaseLock(name, owner, 0) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, errors.Wrap(err, "create lock fail")
+		}
+
+		if st, err := os.Stat(name); err == nil && time.Since(st.ModTime()) > s.staleLock() {
+			if b, err := ioutil.ReadFile(name); err == nil {
+				s.releaseLock(name, string(b), s.staleLock())
+				continue
+			}
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// releaseLock removes the lock file name if it still holds owner and is older than minAge. It runs
+// under the release guard <name>.<owner>.<n>, created exclusively: while the guard is held the lock
+// file of owner can't be removed by anyone else, and no new lock file can appear while it exists. A
+// guard older than StaleLock was left by a crashed process and the next n is used.
+func (s *FileTokenStore) releaseLock(name, owner string, minAge time.Duration) {
+	var guards []string
+	defer func() {
+		for _, g := range guards {
+			os.Remove(g)
+		}
+	}()
+
+	for n := 0; ; n++ {
+		guard := fmt.Sprintf("%s.%s.%d", name, owner, n)
+		f, err := os.OpenFile(guard, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			guards = append(guards, guard)
+			break
+		}
+		if !os.IsExist(err) {
+			return
+		}
+		// another process is releasing the same lock
+		st, err := os.Stat(guard)
+		if err != nil || time.Since(st.ModTime()) <= s.staleLock() {
+			return
+		}
+		guards = append(guards, guard)
+	}
+
+	if b, err := ioutil.ReadFile(name); err != nil || string(b) != owner {
+		return
+	}
+	if st, err := os.Stat(name); err != nil || time.Since(st.ModTime()) < minAge {
+		return
+	}
+	os.Remove(name)
+}
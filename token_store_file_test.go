@@ -0,0 +1,174 @@
+package apns
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Lockers in separate stores stand for separate processes sharing Dir.
+func TestFileTokenStoreLock(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		stale []string // files left by a crashed process
+	}{
+		{name: "free"},
+		{name: "stale lock", stale: []string{"key.lock"}},
+		{name: "stale release guard", stale: []string{"key.lock", "key.lock.crashed.0"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range tt.stale {
+				name := filepath.Join(dir, f)
+				if err := ioutil.WriteFile(name, []byte("crashed"), 0600); err != nil {
+					t.Fatal(err)
+				}
+				old := time.Now().Add(-time.Hour)
+				if err := os.Chtimes(name, old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var (
+				mux     sync.Mutex
+				holders int
+				wg      sync.WaitGroup
+			)
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					s := &FileTokenStore{Dir: dir, StaleLock: time.Minute, PollInterval: time.Millisecond}
+					for j := 0; j < 10; j++ {
+						unlock, err := s.Lock(context.Background(), "key")
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						mux.Lock()
+						holders++
+						if holders > 1 {
+							t.Error("lock held twice")
+						}
+						mux.Unlock()
+
+						time.Sleep(100 * time.Microsecond)
+
+						mux.Lock()
+						holders--
+						mux.Unlock()
+						unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 0 {
+				t.Errorf("%d files left in dir", len(files))
+			}
+		})
+	}
+}
+
+// A holder whose lock was taken over as stale must not remove the new owner's lock.
+func TestFileTokenStoreUnlockTakenOver(t *testing.T) {
+	s := &FileTokenStore{Dir: t.TempDir(), StaleLock: time.Minute, PollInterval: time.Millisecond}
+	name := s.path("key", ".lock")
+
+	unlockOld, err := s.Lock(context.Background(), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(name, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	unlockNew, err := s.Lock(context.Background(), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlockOld()
+	if b, err := ioutil.ReadFile(name); err != nil || string(b) != string(owner) {
+		t.Fatalf("lock of the new owner removed: %q, %v", b, err)
+	}
+
+	unlockNew()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("lock not removed: %v", err)
+	}
+}
+
+// Delete must not remove a token stored under the lock by another process between its compare and remove.
+func TestFileTokenStoreDelete(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	// the refresher stores a new token under the lock and checks it is still there before unlocking
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(stop)
+		s := &FileTokenStore{Dir: dir, PollInterval: time.Millisecond}
+		for i := 0; i < 200; i++ {
+			unlock, err := s.Lock(ctx, "key")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			value := fmt.Sprintf("token-%d", i)
+			if err := s.Set(ctx, "key", StoredToken{Value: value, Issued: time.Now()}, time.Hour); err != nil {
+				t.Error(err)
+			}
+			if v, err := s.Get(ctx, "key"); err != nil || v == nil || v.Value != value {
+				t.Errorf("token %s removed under the lock: %v, %v", value, v, err)
+			}
+			unlock()
+		}
+	}()
+
+	// the other process deletes the token it last saw, as Config does after ExpiredProviderToken
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s := &FileTokenStore{Dir: dir, PollInterval: time.Millisecond}
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			v, err := s.Get(ctx, "key")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if v == nil {
+				continue
+			}
+			if err := s.Delete(ctx, "key", v.Value); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+}
@@ -0,0 +1,172 @@
+package apns
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"time"
+)
+
+type TransportOpts struct {
+	// The number of HTTP/2 connections opened to the APNs host. Apple recommends keeping a few connections
+	// open and reusing them for many notifications instead of opening a connection per request. Defaults to 1.
+	Connections int
+
+	// The maximum number of concurrent streams sent over a single connection. APNs advertises its own limit
+	// in the SETTINGS frame; set this to keep a lower one. Zero means the server limit only.
+	MaxStreamsPerConn int
+
+	// The maximum amount of time to wait for a TCP connection to the APNs host. Defaults to 10 seconds.
+	DialTimeout time.Duration
+
+	// The maximum amount of time to wait for the TLS handshake. Defaults to 10 seconds.
+	TLSHandshakeTimeout time.Duration
+
+	// The maximum amount of time a single push may take, including reading the response. Zero means no limit
+	// other than the context passed to SendContext.
+	ResponseTimeout time.Duration
+
+	// How long a connection without streams in flight is kept open before it is closed. Defaults to 5 minutes;
+	// a negative value keeps idle connections open.
+	IdleConnTimeout time.Duration
+
+	// How often an HTTP/2 PING frame is sent over a connection that received no frames. A connection
+	// that did not carry a push for longer than this is also pinged before it is used again. APNs drops
+	// idle connections without notice, so this detects them before a push is lost. Zero disables pings.
+	PingInterval time.Duration
+
+	// The maximum amount of time to wait for a PING response before the connection is considered dead
+	// and replaced. Defaults to 15 seconds.
+	PingTimeout time.Duration
+
+	// Optional. Called every time a connection that was closed, received GOAWAY or failed a ping is dropped
+	// from the pool; the next push dials a new one. Connections that are only busy are not reported.
+	OnReconnect func(addr string, cause error)
+
+	// The certificate authorities trusted for the APNs host. Nil means the system roots; set it to talk
+	// to a local server such as apnstest.Server.
+	RootCAs *x509.CertPool
+}
+
+func (o TransportOpts) connections() int {
+	if o.Connections <= 0 {
+		return 1
+	}
+	return o.Connections
+}
+
+func (o TransportOpts) dialTimeout() time.Duration {
+	if o.DialTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return o.DialTimeout
+}
+
+func (o TransportOpts) tlsHandshakeTimeout() time.Duration {
+	if o.TLSHandshakeTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return o.TLSHandshakeTimeout
+}
+
+func (o TransportOpts) idleConnTimeout() time.Duration {
+	if o.IdleConnTimeout == 0 {
+		return 5 * time.Minute
+	}
+	if o.IdleConnTimeout < 0 {
+		return 0
+	}
+	return o.IdleConnTimeout
+}
+
+func (o TransportOpts) pingTimeout() time.Duration {
+	if o.PingTimeout <= 0 {
+		return 15 * time.Second
+	}
+	return o.PingTimeout
+}
+
+func hostAddr(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, "443")
+}
+
+func (c *Config) getClient() (*http.Client, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.client == nil {
+		pool, err := c.newPoolLocked(c.Host)
+		if err != nil {
+			return nil, err
+		}
+		c.pool = pool
+		c.client = &http.Client{
+			Transport: c.pool,
+			Timeout:   c.Transport.ResponseTimeout,
+		}
+	}
+	return c.client, nil
+}
+
+// getChannelClient returns the client for the channel management host, the push client if both hosts
+// are the same.
+func (c *Config) getChannelClient() (*http.Client, error) {
+	if c.channelHost() == c.Host {
+		return c.getClient()
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.channelClient == nil {
+		pool, err := c.newPoolLocked(c.channelHost())
+		if err != nil {
+			return nil, err
+		}
+		c.channelPool = pool
+		c.channelClient = &http.Client{
+			Transport: c.channelPool,
+			Timeout:   c.Transport.ResponseTimeout,
+		}
+	}
+	return c.channelClient, nil
+}
+
+func (c *Config) newPoolLocked(host string) (*connPool, error) {
+	tlsCfg := &tls.Config{RootCAs: c.Transport.RootCAs}
+	if c.usesCert() {
+		cert, err := c.getCertLocked()
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert.tls}
+	}
+	return newConnPool(hostAddr(host), c.Transport, tlsCfg), nil
+}
+
+// Close closes all connections opened by Send and stops StartTokenRefresh.
+func (c *Config) Close() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.stopTokenRefresh()
+
+	var err error
+	if c.channelPool != nil {
+		err = c.channelPool.Close()
+		c.channelPool = nil
+		c.channelClient = nil
+	}
+	if c.pool != nil {
+		if e := c.pool.Close(); e != nil {
+			err = e
+		}
+		c.pool = nil
+		c.client = nil
+	}
+	return err
+}
@@ -1,7 +1,10 @@
 package apns
 
 import (
+	"crypto/rand"
+	"fmt"
 	"net/url"
+	"path"
 )
 
 func relativeUrl(s string) (string, error) {
@@ -17,3 +20,23 @@ func relativeUrl(s string) (string, error) {
 
 	return path, nil
 }
+
+// deviceToken returns the device token from a push url.
+func deviceToken(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return path.Base(u.Path)
+}
+
+// newUUID returns a random (version 4) canonical UUID for the apns-id header.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,264 @@
+package apns
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FieldError is a part of a push that APNs would reject.
+type FieldError struct {
+	// The header name, such as apns-priority, "payload" for the whole body, or the payload key path,
+	// such as aps.alert.
+	Field string
+
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError lists every FieldError of a push.
+type ValidationError []*FieldError
+
+func (e ValidationError) Error() string {
+	res := make([]string, len(e))
+	for i, f := range e {
+		res[i] = f.Error()
+	}
+	return "invalid push: " + strings.Join(res, "; ")
+}
+
+// Has reports whether field has an error.
+func (e ValidationError) Has(field string) bool {
+	for _, f := range e {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Validate checks a payload and its headers for the PushType of h. It returns a ValidationError, or nil
+// if APNs should accept the push. payload is marshalled to JSON unless it is a json.RawMessage.
+func Validate(payload interface{}, h Headers) error {
+	b, ok := payload.(json.RawMessage)
+	if !ok {
+		var err error
+		if b, err = json.Marshal(payload); err != nil {
+			return errors.Wrap(err, "json fail")
+		}
+	}
+	if errs := validate(b, h); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func maxPayloadSize(t PushType) int {
+	if t == PushTypeVoip {
+		return 5120
+	}
+	return 4096
+}
+
+func validate(b []byte, h Headers) ValidationError {
+	var errs ValidationError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if h.Id != "" && !uuidRe.MatchString(h.Id) {
+		add("apns-id", "not a canonical uuid")
+	}
+	if len(h.CollapseId) > 64 {
+		add("apns-collapse-id", "%d bytes, max 64", len(h.CollapseId))
+	}
+	switch h.Priority {
+	case 0, 1, 5, 10:
+	default:
+		add("apns-priority", "must be 1, 5 or 10")
+	}
+
+	if max := maxPayloadSize(h.PushType); len(b) > max {
+		add("payload", "%d bytes, max %d", len(b), max)
+	}
+
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(b, &data); err != nil || data == nil {
+		add("payload", "not a json object")
+		return errs
+	}
+
+	var aps map[string]json.RawMessage
+	if raw, ok := data["aps"]; ok {
+		if err := json.Unmarshal(raw, &aps); err != nil {
+			add("aps", "not a json object")
+			return errs
+		}
+	}
+	_, hasAlert := aps["alert"]
+	_, hasSound := aps["sound"]
+	_, hasBadge := aps["badge"]
+	contentAvailable := string(aps["content-available"]) == "1"
+
+	if contentAvailable && !hasAlert && !hasSound && !hasBadge && h.Priority == 10 {
+		add("apns-priority", "content-available pushes must use priority 5")
+	}
+
+	validateAlertOptions(aps, add)
+
+	switch h.PushType {
+	case PushTypeAlert:
+		if !hasAlert && !hasSound && !hasBadge && !contentAvailable {
+			add("aps", "alert push without alert, sound or badge")
+		}
+	case PushTypeBackground:
+		if !contentAvailable {
+			add("aps.content-available", "background push must set content-available to 1")
+		}
+		if hasAlert {
+			add("aps.alert", "not allowed in background push")
+		}
+		if hasSound {
+			add("aps.sound", "not allowed in background push")
+		}
+		if h.Priority == 10 && !errs.Has("apns-priority") {
+			add("apns-priority", "background push must use priority 5")
+		}
+	case PushTypeLiveActivity:
+		validateLiveActivity(aps, hasAlert, add)
+	case PushTypeLocation:
+		if hasAlert || hasSound || hasBadge || contentAvailable {
+			add("aps", "location push must not set alert, sound, badge or content-available")
+		}
+		if h.Priority != 0 && h.Priority != 5 && h.Priority != 10 {
+			add("apns-priority", "location push must use priority 10 or 5")
+		}
+	case PushTypePushToTalk:
+		if hasAlert || hasSound || hasBadge || contentAvailable {
+			add("aps", "push to talk push must not set alert, sound, badge or content-available")
+		}
+		if h.Priority != 0 && h.Priority != 10 {
+			add("apns-priority", "push to talk push must use priority 10")
+		}
+		if !h.Expiration.IsZero() {
+			add("apns-expiration", "push to talk push must not set an expiration")
+		}
+	case PushTypeWidgets, PushTypeControls:
+		if string(aps["content-changed"]) != "true" {
+			add("aps.content-changed", "%s push must set content-changed to true", h.PushType)
+		}
+		if hasAlert || hasSound || hasBadge || contentAvailable {
+			add("aps", "%s push must not set alert, sound, badge or content-available", h.PushType)
+		}
+		if h.Priority != 0 && h.Priority != 5 && h.Priority != 10 {
+			add("apns-priority", "%s push must use priority 10 or 5", h.PushType)
+		}
+	case PushTypeMdm:
+		if _, ok := data["mdm"]; !ok {
+			add("mdm", "mdm push must set the push magic")
+		}
+	}
+	return errs
+}
+
+func validateLiveActivity(aps map[string]json.RawMessage, hasAlert bool, add func(field, format string, args ...interface{})) {
+	var event LiveActivityEvent
+	json.Unmarshal(aps["event"], &event)
+	switch event {
+	case LiveActivityStart, LiveActivityUpdate, LiveActivityEnd:
+	default:
+		add("aps.event", "must be start, update or end")
+	}
+
+	var ts, stale, dismissal int64
+	if err := json.Unmarshal(aps["timestamp"], &ts); err != nil || ts <= 0 {
+		add("aps.timestamp", "required")
+	}
+	if raw, ok := aps["stale-date"]; ok {
+		if err := json.Unmarshal(raw, &stale); err != nil || ts > 0 && stale <= ts {
+			add("aps.stale-date", "must be after timestamp")
+		}
+	}
+	if raw, ok := aps["dismissal-date"]; ok {
+		if event != LiveActivityEnd {
+			add("aps.dismissal-date", "only allowed in end events")
+		} else if err := json.Unmarshal(raw, &dismissal); err != nil || dismissal <= 0 {
+			add("aps.dismissal-date", "not a unix time")
+		}
+	}
+
+	if _, ok := aps["content-state"]; !ok && event != LiveActivityEnd {
+		add("aps.content-state", "required for %s events", event)
+	}
+	_, hasType := aps["attributes-type"]
+	_, hasAttrs := aps["attributes"]
+	if event == LiveActivityStart {
+		if !hasType {
+			add("aps.attributes-type", "required for start events")
+		}
+		if !hasAttrs {
+			add("aps.attributes", "required for start events")
+		}
+		if !hasAlert {
+			add("aps.alert", "required for start events")
+		}
+	} else if hasType || hasAttrs {
+		add("aps.attributes", "only allowed in start events")
+	}
+}
+
+// validateAlertOptions checks the sound dictionary, interruption-level, relevance-score and filter-criteria.
+func validateAlertOptions(aps map[string]json.RawMessage, add func(field, format string, args ...interface{})) {
+	if raw, ok := aps["interruption-level"]; ok {
+		var v InterruptionLevel
+		json.Unmarshal(raw, &v)
+		switch v {
+		case InterruptionPassive, InterruptionActive, InterruptionTimeSensitive, InterruptionCritical:
+		default:
+			add("aps.interruption-level", "must be passive, active, time-sensitive or critical")
+		}
+	}
+
+	if raw, ok := aps["relevance-score"]; ok {
+		var v float64
+		if err := json.Unmarshal(raw, &v); err != nil || v < 0 || v > 1 {
+			add("aps.relevance-score", "must be a number from 0 to 1")
+		}
+	}
+
+	if raw, ok := aps["filter-criteria"]; ok {
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			add("aps.filter-criteria", "must be a string")
+		}
+	}
+
+	if raw, ok := aps["sound"]; ok && len(raw) > 0 && raw[0] == '{' {
+		v := new(struct {
+			Critical *int     `json:"critical"`
+			Name     *string  `json:"name"`
+			Volume   *float64 `json:"volume"`
+		})
+		if err := json.Unmarshal(raw, v); err != nil {
+			add("aps.sound", "not a sound dictionary")
+			return
+		}
+		if v.Critical != nil && *v.Critical != 0 && *v.Critical != 1 {
+			add("aps.sound.critical", "must be 0 or 1")
+		}
+		if v.Name == nil || *v.Name == "" {
+			add("aps.sound.name", "required")
+		}
+		if v.Volume != nil && (*v.Volume < 0 || *v.Volume > 1) {
+			add("aps.sound.volume", "must be from 0 to 1")
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package apns
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestValidatePushTypes(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		payload interface{}
+		h       Headers
+		fields  []string
+	}{
+		{name: "location", payload: LocationPush{Data: map[string]interface{}{"id": 1}}.Payload(), h: Headers{PushType: PushTypeLocation}},
+		{name: "location alert", payload: NewPayload().AlertBody("Hi"), h: Headers{PushType: PushTypeLocation}, fields: []string{"aps"}},
+		{name: "location content-available", payload: NewPayload().ContentAvailable(), h: Headers{PushType: PushTypeLocation, Priority: 5}, fields: []string{"aps"}},
+		{name: "location priority 1", payload: NewPayload(), h: Headers{PushType: PushTypeLocation, Priority: 1}, fields: []string{"apns-priority"}},
+		{name: "widgets", payload: WidgetsPush{}.Payload(), h: Headers{PushType: PushTypeWidgets}},
+		{name: "widgets no content-changed", payload: NewPayload(), h: Headers{PushType: PushTypeWidgets}, fields: []string{"aps.content-changed"}},
+		{name: "widgets badge", payload: NewPayload().ContentChanged().Badge(1), h: Headers{PushType: PushTypeWidgets}, fields: []string{"aps"}},
+		{name: "controls", payload: ControlsPush{}.Payload(), h: Headers{PushType: PushTypeControls, Priority: 5}},
+		{name: "controls sound", payload: NewPayload().ContentChanged().Sound("default"), h: Headers{PushType: PushTypeControls}, fields: []string{"aps"}},
+		{name: "push to talk", payload: PushToTalkPush{}.Payload(), h: Headers{PushType: PushTypePushToTalk, Priority: 10}},
+		{name: "push to talk expiration", payload: NewPayload(), h: Headers{PushType: PushTypePushToTalk, Expiration: time.Now()}, fields: []string{"apns-expiration"}},
+		{name: "push to talk priority 5", payload: NewPayload(), h: Headers{PushType: PushTypePushToTalk, Priority: 5}, fields: []string{"apns-priority"}},
+		{name: "not an object", payload: json.RawMessage(`[]`), h: Headers{PushType: PushTypeAlert}, fields: []string{"payload"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.payload, tt.h)
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			errs, ok := err.(ValidationError)
+			if !ok {
+				t.Fatalf("err: got %v, want ValidationError", err)
+			}
+			if len(errs) != len(tt.fields) {
+				t.Errorf("err: got %v, want %v", errs, tt.fields)
+			}
+			for _, f := range tt.fields {
+				if !errs.Has(f) {
+					t.Errorf("no %s error in %v", f, errs)
+				}
+			}
+		})
+	}
+}
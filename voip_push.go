@@ -1,11 +1,14 @@
 package apns
 
 import (
+	"context"
 	"fmt"
 )
 
+// Push is a notification for a single device: AlertPush, BackgroundPush, VoipPush, LiveActivityPush,
+// PushToTalkPush, LocationPush, WidgetsPush, ControlsPush or MdmPush.
 type Push interface {
-	Send(c *Config)
+	SendContext(ctx context.Context, c *Config, h *Headers) Result
 }
 
 type VoipPush struct {
@@ -16,26 +19,21 @@ type VoipPush struct {
 	Token string
 }
 
-func (p VoipPush) Send(c *Config, h *Headers) (r Result) {
-	url := fmt.Sprintf(urlMask, c.Host, p.Token)
-
-	req := make(map[string]interface{})
-	for k, v := range p.Data {
-		req[k] = v
-	}
-
-	req["apns"] = aps{
-		Badge: p.Badge,
-		Alert: &alert{
-			Title: p.Title,
-			Body:  p.Body,
-		},
-	}
+// Payload builds the notification payload.
+func (p VoipPush) Payload() *Payload {
+	res := NewPayload().
+		CustomData(p.Data).
+		AlertTitle(p.Title).
+		AlertBody(p.Body)
+	res.Aps.Badge = p.Badge
+	return res
+}
 
-	if h == nil {
-		h = new(Headers)
-	}
-	h.PushType = PushTypeVoip
+func (p VoipPush) Send(c *Config, h *Headers) (r Result) {
+	return p.SendContext(context.Background(), c, h)
+}
 
-	return c.Send(url, req, *h, nil)
+func (p VoipPush) SendContext(ctx context.Context, c *Config, h *Headers) (r Result) {
+	url := fmt.Sprintf(urlMask, c.Host, p.Token)
+	return c.SendContext(ctx, url, p.Payload(), pushHeaders(h, PushTypeVoip), nil)
 }
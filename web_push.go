@@ -1,14 +1,15 @@
 package apns
 
 import (
+	"context"
 	"fmt"
 )
 
 type WebPush struct {
-	// The title of the notification.
+	// The title of the notification. Required.
 	Title string
 
-	// The body of the notification.
+	// The body of the notification. Required: Safari drops a notification without one.
 	Body string
 
 	// Optional. The label of the action button
@@ -25,20 +26,44 @@ type WebPush struct {
 	Token string
 }
 
-func (p WebPush) Send(c *Config) (r Result) {
-	url := fmt.Sprintf(urlMask, c.Host, p.Token)
+// Payload builds the notification payload.
+func (p WebPush) Payload() *Payload {
+	return NewPayload().
+		AlertTitle(p.Title).
+		AlertBody(p.Body).
+		AlertAction(p.Action).
+		UrlArgs(p.UrlArgs...)
+}
 
-	req := new(struct {
-		Aps aps `json:"aps"`
-	})
+// Validate checks that the title and body are set. The alert omits empty keys, so an empty body would
+// be dropped from the payload.
+func (p WebPush) Validate() error {
+	var errs ValidationError
+	if p.Title == "" {
+		errs = append(errs, &FieldError{Field: "aps.alert.title", Message: "required for Safari"})
+	}
+	if p.Body == "" {
+		errs = append(errs, &FieldError{Field: "aps.alert.body", Message: "required for Safari"})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
 
-	req.Aps.UrlArgs = &p.UrlArgs
-	req.Aps.Alert = &alert{
-		Title:  p.Title,
-		Body:   p.Body,
-		Action: p.Action,
+func (p WebPush) Send(c *Config) (r Result) {
+	return p.SendContext(context.Background(), c)
+}
+
+func (p WebPush) SendContext(ctx context.Context, c *Config) (r Result) {
+	if err := p.Validate(); err != nil {
+		r.Code = FailNow
+		r.Error = err
+		return
 	}
 
+	url := fmt.Sprintf(urlMask, c.Host, p.Token)
+
 	client, err := c.getSafariClient()
 	if err != nil {
 		r.Code = FailNow
@@ -46,5 +71,5 @@ func (p WebPush) Send(c *Config) (r Result) {
 		return
 	}
 
-	return c.Send(url, req, Headers{}, client)
+	return c.SendContext(ctx, url, p.Payload(), Headers{}, client)
 }
@@ -0,0 +1,68 @@
+package apns
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWebPushValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		push   WebPush
+		fields []string
+	}{
+		{name: "ok", push: WebPush{Title: "Hi", Body: "New message"}},
+		{name: "no body", push: WebPush{Title: "Hi"}, fields: []string{"aps.alert.body"}},
+		{name: "no title", push: WebPush{Body: "New message"}, fields: []string{"aps.alert.title"}},
+		{name: "empty", fields: []string{"aps.alert.title", "aps.alert.body"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.push.Validate()
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				b, err := json.Marshal(tt.push.Payload())
+				if err != nil {
+					t.Fatal(err)
+				}
+				var v struct {
+					Aps struct {
+						Alert map[string]string `json:"alert"`
+					} `json:"aps"`
+				}
+				if err := json.Unmarshal(b, &v); err != nil {
+					t.Fatal(err)
+				}
+				if v.Aps.Alert["title"] != tt.push.Title || v.Aps.Alert["body"] != tt.push.Body {
+					t.Errorf("payload: %s", b)
+				}
+				return
+			}
+
+			errs, ok := err.(ValidationError)
+			if !ok {
+				t.Fatalf("err: got %v, want ValidationError", err)
+			}
+			if len(errs) != len(tt.fields) {
+				t.Errorf("err: got %v, want %v", errs, tt.fields)
+			}
+			for _, f := range tt.fields {
+				if !errs.Has(f) {
+					t.Errorf("no %s error in %v", f, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestWebPushSendEmptyBody(t *testing.T) {
+	r := WebPush{Title: "Hi", Token: "token"}.Send(&Config{})
+	if r.Code != FailNow {
+		t.Errorf("code: got %v, want FailNow", r.Code)
+	}
+	if errs, ok := r.Error.(ValidationError); !ok || !errs.Has("aps.alert.body") {
+		t.Errorf("err: got %v", r.Error)
+	}
+}
@@ -0,0 +1,48 @@
+package apns
+
+import (
+	"context"
+	"fmt"
+)
+
+// WidgetsPush asks the system to reload the widgets of the app. Send it to the widget push token.
+type WidgetsPush struct {
+	Token string
+}
+
+// ControlsPush asks the system to reload the controls of the app. Send it to the controls push token.
+type ControlsPush struct {
+	Token string
+}
+
+// Payload builds the notification payload.
+func (p WidgetsPush) Payload() *Payload {
+	return NewPayload().ContentChanged()
+}
+
+func (p WidgetsPush) Send(c *Config, h *Headers) (r Result) {
+	return p.SendContext(context.Background(), c, h)
+}
+
+func (p WidgetsPush) SendContext(ctx context.Context, c *Config, h *Headers) (r Result) {
+	return sendContentChanged(ctx, c, p.Token, pushHeaders(h, PushTypeWidgets))
+}
+
+// Payload builds the notification payload.
+func (p ControlsPush) Payload() *Payload {
+	return NewPayload().ContentChanged()
+}
+
+func (p ControlsPush) Send(c *Config, h *Headers) (r Result) {
+	return p.SendContext(context.Background(), c, h)
+}
+
+func (p ControlsPush) SendContext(ctx context.Context, c *Config, h *Headers) (r Result) {
+	return sendContentChanged(ctx, c, p.Token, pushHeaders(h, PushTypeControls))
+}
+
+// sendContentChanged sends the content-changed payload shared by widgets and controls pushes.
+func sendContentChanged(ctx context.Context, c *Config, token string, h Headers) Result {
+	url := fmt.Sprintf(urlMask, c.Host, token)
+	return c.SendContext(ctx, url, NewPayload().ContentChanged(), h, nil)
+}